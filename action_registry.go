@@ -0,0 +1,99 @@
+package go_fsm
+
+import "sync"
+
+// ActionRegistry keeps named functions which are referenced by definition documents (see LoadDefinition).
+// It is safe for concurrent use.
+type ActionRegistry struct {
+	mu                sync.RWMutex
+	actions           map[string]ActionFunc
+	transitionActions map[string]TransitionAction
+	guards            map[string]Guard
+	hooks             map[string]TransitionFunc
+	compensations     map[string]Compensation
+}
+
+func NewActionRegistry() *ActionRegistry {
+	return &ActionRegistry{
+		actions:           map[string]ActionFunc{},
+		transitionActions: map[string]TransitionAction{},
+		guards:            map[string]Guard{},
+		hooks:             map[string]TransitionFunc{},
+		compensations:     map[string]Compensation{},
+	}
+}
+
+// RegisterAction add action function which is referenced by states, all-state events and the unhandled event action
+func (r *ActionRegistry) RegisterAction(name string, action ActionFunc) *ActionRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.actions[name] = action
+	return r
+}
+
+// RegisterTransitionAction add action which is referenced by declarative transitions
+func (r *ActionRegistry) RegisterTransitionAction(name string, action TransitionAction) *ActionRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transitionActions[name] = action
+	return r
+}
+
+// RegisterGuard add guard which is referenced by declarative transitions, the name is used in diagrams and reports
+func (r *ActionRegistry) RegisterGuard(name string, guard Guard) *ActionRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.guards[name] = guard
+	return r
+}
+
+// RegisterHook add transition function which is referenced by pre commit and post transition hooks
+func (r *ActionRegistry) RegisterHook(name string, fn TransitionFunc) *ActionRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks[name] = fn
+	return r
+}
+
+// RegisterCompensation add compensation which is referenced by declarative transitions
+func (r *ActionRegistry) RegisterCompensation(name string, compensation Compensation) *ActionRegistry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compensations[name] = compensation
+	return r
+}
+
+func (r *ActionRegistry) action(name string) (ActionFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	action, ok := r.actions[name]
+	return action, ok
+}
+
+func (r *ActionRegistry) transitionAction(name string) (TransitionAction, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	action, ok := r.transitionActions[name]
+	return action, ok
+}
+
+func (r *ActionRegistry) guard(name string) (Guard, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	guard, ok := r.guards[name]
+	return guard, ok
+}
+
+func (r *ActionRegistry) hook(name string) (TransitionFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fn, ok := r.hooks[name]
+	return fn, ok
+}
+
+func (r *ActionRegistry) compensation(name string) (Compensation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	compensation, ok := r.compensations[name]
+	return compensation, ok
+}
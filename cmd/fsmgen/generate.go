@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	go_fsm "github.com/igorrius/go-fsm"
+)
+
+type config struct {
+	// prefix of generated names
+	typeName string
+	pkg      string
+	// name of the definition file which is mentioned in comments
+	source string
+}
+
+type handlerKind int
+
+const (
+	actionHandler handlerKind = iota
+	transitionActionHandler
+	guardHandler
+	compensationHandler
+	hookHandler
+)
+
+var handlerKinds = map[handlerKind]struct {
+	name      string
+	signature string
+}{
+	actionHandler: {
+		name:      "action function",
+		signature: "(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (next go_fsm.State, nextFsmCtx go_fsm.FsmContext, err error)",
+	},
+	transitionActionHandler: {
+		name:      "transition action",
+		signature: "(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.FsmContext, error)",
+	},
+	guardHandler: {
+		name:      "guard",
+		signature: "(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) bool",
+	},
+	compensationHandler: {
+		name:      "compensation",
+		signature: "(eventCtx go_fsm.EventContext) error",
+	},
+	hookHandler: {
+		name:      "transition function",
+		signature: "(from, to go_fsm.State, fsmCtx go_fsm.FsmContext) error",
+	},
+}
+
+// function referenced by the definition file, it's a method of the handlers interface
+type handler struct {
+	name   string
+	method string
+	kind   handlerKind
+	// where the function is used
+	usages []string
+}
+
+// generated code model
+type generator struct {
+	cfg      config
+	doc      *go_fsm.Document
+	states   []string
+	events   []string
+	consts   map[string]string
+	handlers []*handler
+	byName   map[string]*handler
+	byMethod map[string]*handler
+}
+
+// generate Go code of the document
+func generate(doc *go_fsm.Document, cfg config) ([]byte, error) {
+	g := &generator{
+		cfg:      cfg,
+		doc:      doc,
+		consts:   map[string]string{},
+		byName:   map[string]*handler{},
+		byMethod: map[string]*handler{},
+	}
+	if err := g.collect(); err != nil {
+		return nil, err
+	}
+
+	code, err := format.Source(g.write())
+	if err != nil {
+		return nil, fmt.Errorf("can't format generated code: %w", err)
+	}
+	return code, nil
+}
+
+// collect constants and handlers in order of appearance
+func (g *generator) collect() error {
+	for _, s := range g.doc.States {
+		if err := g.addConst("State", s.Name); err != nil {
+			return err
+		}
+		g.states = append(g.states, s.Name)
+	}
+	seen := map[string]bool{}
+	addEvent := func(event string) error {
+		if seen[event] {
+			return nil
+		}
+		seen[event] = true
+		g.events = append(g.events, event)
+		return g.addConst("Event", event)
+	}
+
+	for _, s := range g.doc.States {
+		if s.Action != "" {
+			if err := g.addHandler(s.Action, actionHandler, fmt.Sprintf("state [%s]", s.Name)); err != nil {
+				return err
+			}
+		}
+		if s.Timeout != nil {
+			if err := addEvent(s.Timeout.Event); err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range g.doc.Transitions {
+		if err := addEvent(t.Event); err != nil {
+			return err
+		}
+		usage := fmt.Sprintf("transition [%s -> %s] on event [%s]", t.From, t.To, t.Event)
+		for _, ref := range []struct {
+			name string
+			kind handlerKind
+		}{{t.Guard, guardHandler}, {t.Action, transitionActionHandler}, {t.Compensation, compensationHandler}} {
+			if ref.name == "" {
+				continue
+			}
+			if err := g.addHandler(ref.name, ref.kind, usage); err != nil {
+				return err
+			}
+		}
+	}
+	for _, a := range g.doc.Any {
+		if err := addEvent(a.Event); err != nil {
+			return err
+		}
+		if err := g.addHandler(a.Action, actionHandler, fmt.Sprintf("event [%s] in all states", a.Event)); err != nil {
+			return err
+		}
+	}
+	if g.doc.Unhandled != "" {
+		if err := g.addHandler(g.doc.Unhandled, actionHandler, "unhandled events"); err != nil {
+			return err
+		}
+	}
+	for _, h := range g.doc.Hooks {
+		usage := fmt.Sprintf("%s [%s -> %s]", h.Kind, hookState(h.From), hookState(h.To))
+		switch h.Kind {
+		case go_fsm.HookEntry:
+			usage = fmt.Sprintf("%s [%s]", h.Kind, h.To)
+		case go_fsm.HookExit:
+			usage = fmt.Sprintf("%s [%s]", h.Kind, h.From)
+		}
+		if err := g.addHandler(h.Func, hookHandler, usage); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *generator) addConst(kind, value string) error {
+	name := g.cfg.typeName + kind + identifier(value)
+	if other, ok := g.consts[name]; ok && other != value {
+		return fmt.Errorf("%s names [%s] and [%s] have the same identifier %s", strings.ToLower(kind), other, value, name)
+	}
+	g.consts[name] = value
+	return nil
+}
+
+func (g *generator) addHandler(name string, kind handlerKind, usage string) error {
+	if h, ok := g.byName[name]; ok {
+		if h.kind != kind {
+			return fmt.Errorf("function [%s] is used as %s and %s", name, handlerKinds[h.kind].name, handlerKinds[kind].name)
+		}
+		h.usages = append(h.usages, usage)
+		return nil
+	}
+
+	method := identifier(name)
+	if method == "" || !unicode.IsLetter([]rune(method)[0]) {
+		return fmt.Errorf("function name [%s] can't be converted to a method name", name)
+	}
+	if other, ok := g.byMethod[method]; ok {
+		return fmt.Errorf("function names [%s] and [%s] have the same method name %s", other.name, name, method)
+	}
+	h := &handler{name: name, method: method, kind: kind, usages: []string{usage}}
+	g.handlers = append(g.handlers, h)
+	g.byName[name], g.byMethod[method] = h, h
+	return nil
+}
+
+func (g *generator) state(name string) string {
+	if name == "*" {
+		return strconv.Quote(name)
+	}
+	return g.cfg.typeName + "State" + identifier(name)
+}
+
+func (g *generator) event(name string) string {
+	return g.cfg.typeName + "Event" + identifier(name)
+}
+
+func (g *generator) method(name string) string {
+	return "h." + g.byName[name].method
+}
+
+func (g *generator) write() []byte {
+	name := g.cfg.typeName
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "// Code generated by fsmgen from %s. DO NOT EDIT.\n\n", g.cfg.source)
+	fmt.Fprintf(buf, "package %s\n\n", g.cfg.pkg)
+	buf.WriteString("import (\n")
+	if g.hasTimeouts() {
+		buf.WriteString("\"time\"\n\n")
+	}
+	buf.WriteString("go_fsm \"github.com/igorrius/go-fsm\"\n)\n\n")
+
+	fmt.Fprintf(buf, "// States of %s\nconst (\n", name)
+	for _, state := range g.states {
+		fmt.Fprintf(buf, "%s go_fsm.State = %q\n", g.state(state), state)
+	}
+	buf.WriteString(")\n\n")
+
+	if len(g.events) > 0 {
+		fmt.Fprintf(buf, "// Events of %s\nconst (\n", name)
+		for _, event := range g.events {
+			fmt.Fprintf(buf, "%s go_fsm.Event = %q\n", g.event(event), event)
+		}
+		buf.WriteString(")\n\n")
+	}
+
+	fmt.Fprintf(buf, "// %sInitialState is the initial state declared by %s\n", name, g.cfg.source)
+	fmt.Fprintf(buf, "const %sInitialState = %s\n\n", name, g.state(g.doc.Initial))
+
+	fmt.Fprintf(buf, "// %sHandlers provides functions referenced by %s\n", name, g.cfg.source)
+	fmt.Fprintf(buf, "type %sHandlers interface {\n", name)
+	for _, h := range g.handlers {
+		fmt.Fprintf(buf, "// %s is %s [%s] of %s\n", h.method, handlerKinds[h.kind].name, h.name, strings.Join(h.usages, ", "))
+		fmt.Fprintf(buf, "%s%s\n", h.method, handlerKinds[h.kind].signature)
+	}
+	buf.WriteString("}\n\n")
+
+	fmt.Fprintf(buf, "// New%sDefinition create the definition described by %s with functions of the handlers\n", name, g.cfg.source)
+	fmt.Fprintf(buf, "func New%sDefinition(h %sHandlers, opts ...go_fsm.Option) *go_fsm.Definition {\n", name, name)
+	if len(g.handlers) == 0 {
+		buf.WriteString("_ = h\n")
+	}
+	buf.WriteString("return go_fsm.NewDefinition(opts...)")
+	for _, s := range g.doc.States {
+		action := "nil"
+		if s.Action != "" {
+			action = g.method(s.Action)
+		}
+		fmt.Fprintf(buf, ".\nWhen(%s, %s)", g.state(s.Name), action)
+		if s.Final {
+			fmt.Fprintf(buf, ".\nFinal(%s)", g.state(s.Name))
+		}
+		if s.Timeout != nil {
+			fmt.Fprintf(buf, ".\nStateTimeout(%s, %s, %s)", g.state(s.Name), durationExpr(s.Timeout.After), g.event(s.Timeout.Event))
+		}
+	}
+	for _, t := range g.doc.Transitions {
+		fmt.Fprintf(buf, ".\nOn(%s, %s, %s", g.state(t.From), g.event(t.Event), g.state(t.To))
+		if t.Guard != "" {
+			fmt.Fprintf(buf, ", go_fsm.GuardOption(%q, %s)", t.Guard, g.method(t.Guard))
+		}
+		if t.Action != "" {
+			fmt.Fprintf(buf, ", go_fsm.TransitionActionOption(%s)", g.method(t.Action))
+		}
+		if t.Compensation != "" {
+			fmt.Fprintf(buf, ", go_fsm.CompensationOption(%s)", g.method(t.Compensation))
+		}
+		if t.Internal {
+			buf.WriteString(", go_fsm.InternalOption()")
+		}
+		buf.WriteString(")")
+	}
+	for _, a := range g.doc.Any {
+		fmt.Fprintf(buf, ".\nWhenAny(%s, %s)", g.event(a.Event), g.method(a.Action))
+	}
+	if g.doc.Unhandled != "" {
+		fmt.Fprintf(buf, ".\nWhenUnhandled(%s)", g.method(g.doc.Unhandled))
+	}
+	for _, h := range g.doc.Hooks {
+		switch h.Kind {
+		case go_fsm.HookEntry:
+			fmt.Fprintf(buf, ".\nOnEnter(%s, %s)", g.state(h.To), g.method(h.Func))
+		case go_fsm.HookExit:
+			fmt.Fprintf(buf, ".\nOnExit(%s, %s)", g.state(h.From), g.method(h.Func))
+		case go_fsm.HookPreCommit:
+			fmt.Fprintf(buf, ".\nRegisterPreCommitFunc(%s, %s, %s)", g.state(hookState(h.From)), g.state(hookState(h.To)), g.method(h.Func))
+		default:
+			fmt.Fprintf(buf, ".\nRegisterPostTransitionFunc(%s, %s, %s)", g.state(hookState(h.From)), g.state(hookState(h.To)), g.method(h.Func))
+		}
+	}
+	buf.WriteString("\n}\n\n")
+
+	fmt.Fprintf(buf, "// New%s create FSM described by %s in the initial state\n", name, g.cfg.source)
+	fmt.Fprintf(buf, "func New%s(h %sHandlers, opts ...go_fsm.Option) (*go_fsm.Fsm, error) {\n", name, name)
+	fmt.Fprintf(buf, "return New%sDefinition(h, opts...).NewInstance(%sInitialState)\n}\n", name, name)
+
+	return buf.Bytes()
+}
+
+func (g *generator) hasTimeouts() bool {
+	for _, s := range g.doc.States {
+		if s.Timeout != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// an empty hook state matches any state
+func hookState(state string) string {
+	if state == "" {
+		return "*"
+	}
+	return state
+}
+
+// Go expression of the duration, e.g. 90*time.Second, the duration is validated by the parser
+func durationExpr(value string) string {
+	d, _ := time.ParseDuration(value)
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+		{time.Microsecond, "time.Microsecond"},
+	}
+	for _, unit := range units {
+		if d%unit.d == 0 {
+			if d == unit.d {
+				return unit.name
+			}
+			return fmt.Sprintf("%d * %s", d/unit.d, unit.name)
+		}
+	}
+	return fmt.Sprintf("%d * time.Nanosecond", d)
+}
+
+// exported identifier made of letters and digits of the name, e.g. "order.payment-pending" -> "OrderPaymentPending"
+func identifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
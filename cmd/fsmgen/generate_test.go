@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	go_fsm "github.com/igorrius/go-fsm"
+	"github.com/stretchr/testify/assert"
+)
+
+// the example is generated by go generate, it must be up to date and it's compiled with the module
+func TestGenerate_Example(t *testing.T) {
+	dir := filepath.Join("..", "..", "example", "order")
+	tmp, err := ioutil.TempDir("", "fsmgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	output := filepath.Join(tmp, "order_fsm.go")
+	assert.NoError(t, run(filepath.Join(dir, "order.yaml"), output, config{typeName: "Order", pkg: "order"}))
+
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "order_fsm.go"))
+	assert.NoError(t, err)
+	generated, err := ioutil.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(generated))
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		err      string
+	}{
+		{
+			name:     "State identifiers",
+			document: "initial: order.new\nstates: [{name: order.new}, {name: order-new}]",
+			err:      "state names [order.new] and [order-new] have the same identifier TStateOrderNew",
+		},
+		{
+			name:     "Function kinds",
+			document: "initial: a\nstates: [{name: a, action: check}]\ntransitions: [{from: a, event: go, to: a, guard: check}]",
+			err:      "function [check] is used as action function and guard",
+		},
+		{
+			name:     "Method names",
+			document: "initial: a\nstates: [{name: a, action: do_it}]\nany: [{event: go, action: doIt}]",
+			err:      "function names [do_it] and [doIt] have the same method name DoIt",
+		},
+		{
+			name:     "Invalid method name",
+			document: "initial: a\nstates: [{name: a, action: 1st}]",
+			err:      "function name [1st] can't be converted to a method name",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := go_fsm.ParseDocument([]byte(test.document))
+			if !assert.NoError(t, err) {
+				return
+			}
+			code, err := generate(doc, config{typeName: "T", pkg: "p", source: "t.yaml"})
+			assert.Nil(t, code)
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
+
+func TestRun_DocumentErrors(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "fsmgen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	path := filepath.Join(tmp, "broken.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("initial: a\nstates:\n  - {name: b}\n"), 0644))
+	assert.EqualError(t, run(path, "", config{}), path+":1:10: unknown initial state [a]")
+}
+
+func Test_durationExpr(t *testing.T) {
+	assert.Equal(t, "time.Hour", durationExpr("1h"))
+	assert.Equal(t, "90 * time.Minute", durationExpr("1h30m"))
+	assert.Equal(t, "1500 * time.Millisecond", durationExpr("1.5s"))
+	assert.Equal(t, "3 * time.Nanosecond", durationExpr("3ns"))
+}
+
+func Test_identifier(t *testing.T) {
+	assert.Equal(t, "OrderPaymentPending", identifier("order.payment-pending"))
+	assert.Equal(t, "HasFunds", identifier("hasFunds"))
+	assert.Equal(t, "", identifier("*"))
+}
@@ -0,0 +1,87 @@
+// Command fsmgen generates Go code from a definition file (YAML, JSON or SCXML, see go_fsm.Document):
+// typed constants of states and events, an interface of handlers referenced by the file and
+// a constructor which wires them, so a missing handler is a compile error.
+//
+// Usage with go generate:
+//
+//	//go:generate go run github.com/igorrius/go-fsm/cmd/fsmgen -type Order order.yaml
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	go_fsm "github.com/igorrius/go-fsm"
+)
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.typeName, "type", "", "prefix of generated names (derived from the file name by default)")
+	flag.StringVar(&cfg.pkg, "package", os.Getenv("GOPACKAGE"), "package of the generated file ($GOPACKAGE by default)")
+	output := flag.String("o", "", "output file (<file>_fsm.go by default)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: fsmgen [flags] definition.(yaml|json|scxml)\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *output, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(path, output string, cfg config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	doc, err := parse(path, data)
+	var docErrs go_fsm.DocumentErrors
+	if errors.As(err, &docErrs) {
+		messages := make([]string, len(docErrs))
+		for i, e := range docErrs {
+			messages[i] = fmt.Sprintf("%s:%d:%d: %s", path, e.Line, e.Column, e.Message)
+		}
+		return errors.New(strings.Join(messages, "\n"))
+	}
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if cfg.typeName == "" {
+		cfg.typeName = identifier(base)
+	}
+	if cfg.pkg == "" {
+		cfg.pkg = "main"
+	}
+	cfg.source = filepath.Base(path)
+	if output == "" {
+		output = filepath.Join(filepath.Dir(path), base+"_fsm.go")
+	}
+
+	code, err := generate(doc, cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return ioutil.WriteFile(output, code, 0644)
+}
+
+// parse the definition file by its extension
+func parse(path string, data []byte) (*go_fsm.Document, error) {
+	if strings.EqualFold(filepath.Ext(path), ".scxml") {
+		return go_fsm.ParseSCXML(data)
+	}
+	return go_fsm.ParseDocument(data)
+}
@@ -0,0 +1,188 @@
+package go_fsm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Compensation undoes side effects of an applied step, it receives the event context of the step
+type Compensation = func(eventCtx EventContext) error
+
+type ctxTransactionKey int
+
+var transactionCtxKey ctxTransactionKey
+
+// transaction groups steps (processed events) which are committed or rolled back together
+type transaction struct {
+	savepoint savepoint
+	steps     []TransitionNotification
+
+	mu            sync.Mutex
+	compensations []registeredCompensation
+}
+
+// FSM state and context before the transaction
+type savepoint struct {
+	state        State
+	ctx          FsmContext
+	timeoutEvent Event
+	deadline     time.Time
+}
+
+type registeredCompensation struct {
+	fn       Compensation
+	eventCtx EventContext
+}
+
+//Compensate register compensation of side effects made by the action function processing the event.
+//If the event or a later step of the same transaction fails (a pre-commit function, the persistence save
+//or another event of ProcessBatch), registered compensations are called in reverse order and FSM returns
+//to the state and context it had before. It returns false if the context doesn't belong to an event processing
+//or the event is evaluated by a dry run (see IsDryRun).
+func Compensate(eventCtx EventContext, fn Compensation) bool {
+	tx, ok := eventCtx.Value(transactionCtxKey).(*transaction)
+	if !ok || IsDryRun(eventCtx) {
+		return false
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.compensations = append(tx.compensations, registeredCompensation{fn: fn, eventCtx: eventCtx})
+	return true
+}
+
+func ctxWithTransaction(ctx context.Context, tx *transaction) context.Context {
+	return context.WithValue(ctx, transactionCtxKey, tx)
+}
+
+// call compensations in reverse order, a panic is converted to PanicError
+func (tx *transaction) compensate() []error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	var errs []error
+	for i := len(tx.compensations) - 1; i >= 0; i-- {
+		c := tx.compensations[i]
+		if err := callCompensation(c.fn, c.eventCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	tx.compensations = nil
+	return errs
+}
+
+func callCompensation(fn Compensation, eventCtx EventContext) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			state, _ := StateFromCtx(eventCtx)
+			event, _ := EventFromCtx(eventCtx)
+			err = newPanicError(p, state, event)
+		}
+	}()
+
+	return fn(eventCtx)
+}
+
+// begin a transaction from the current state and context
+func (fsm *Fsm) begin() *transaction {
+	// FSM whose parent context is done is closed before the transaction starts
+	fsm.closeIfCanceled()
+	return &transaction{
+		savepoint: savepoint{
+			state:        fsm.state,
+			ctx:          fsm.ctx,
+			timeoutEvent: fsm.timeoutEvent,
+			deadline:     fsm.deadline,
+		},
+	}
+}
+
+// persist the transaction result if a store is configured, then report and publish applied steps
+func (fsm *Fsm) commit(tx *transaction, eventCtx EventContext) error {
+	if len(tx.steps) == 0 {
+		return nil
+	}
+
+	if store := fsm.def.options.Store; store != nil {
+		snapshot, err := fsm.Snapshot(fsm.def.options.DataCodec)
+		if err == nil {
+			err = store.Save(checkAndFixEmptyContext(eventCtx), snapshot)
+		}
+		if err != nil {
+			last := tx.steps[len(tx.steps)-1]
+			fsm.logger.Error("FSM persistence failed",
+				Field{Key: FieldState, Value: tx.savepoint.state},
+				Field{Key: FieldNextState, Value: last.To},
+				Field{Key: FieldError, Value: err},
+			)
+			return fsm.rollback(tx, func() error {
+				return fsm.fail(last.Event, last.To, err)
+			})
+		}
+	}
+
+	for _, step := range tx.steps {
+		if !step.Internal {
+			fsm.def.metrics.StateExited(step.From)
+			fsm.def.metrics.StateEntered(step.To)
+		}
+		fsm.subscribers.publish(step)
+	}
+
+	if def := fsm.def.load(); def.finalStates[fsm.state] {
+		fsm.terminate(def, ReasonFinalState)
+	}
+	return nil
+}
+
+// call compensations and return to the savepoint, the error is created by fail after that
+func (fsm *Fsm) rollback(tx *transaction, fail func() error) error {
+	errs := tx.compensate()
+	fsm.state, fsm.ctx = tx.savepoint.state, tx.savepoint.ctx
+	fsm.timeoutEvent, fsm.deadline = tx.savepoint.timeoutEvent, tx.savepoint.deadline
+
+	err := fail()
+	if len(errs) > 0 {
+		fsm.logger.Error("Compensation failed",
+			Field{Key: FieldState, Value: fsm.state},
+			Field{Key: FieldError, Value: errs[0]},
+		)
+		return &CompensationError{Cause: err, Errors: errs}
+	}
+	return err
+}
+
+//ProcessBatch process events one by one as a single transaction: if any event fails, compensations of
+//all applied steps are called in reverse order and FSM returns to the state and context it had before the batch.
+//Subscribers are notified and the persistence save is done only when the whole batch succeeds.
+func (fsm *Fsm) ProcessBatch(events []Event, eventCtx EventContext) error {
+	tx := fsm.begin()
+	for _, event := range events {
+		if err := fsm.processStep(tx, event, eventCtx); err != nil {
+			return fsm.rollback(tx, func() error { return err })
+		}
+	}
+	return fsm.commit(tx, eventCtx)
+}
+
+// CompensationError is returned when the transaction has been rolled back but some compensations failed
+type CompensationError struct {
+	// error which caused the rollback
+	Cause  error
+	Errors []error
+}
+
+func (e *CompensationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%s (compensation failed: %s)", e.Cause, strings.Join(msgs, "; "))
+}
+
+func (e *CompensationError) Unwrap() error {
+	return e.Cause
+}
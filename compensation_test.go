@@ -0,0 +1,144 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStore struct {
+	*MemoryStore
+	err error
+}
+
+func (s *failingStore) Save(ctx context.Context, snapshot Snapshot) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.MemoryStore.Save(ctx, snapshot)
+}
+
+// definition of a workflow where each step records its compensation
+func newSagaDefinition(compensated *[]string, opts ...Option) *Definition {
+	step := func(name string) TransitionOption {
+		return CompensationOption(func(eventCtx EventContext) error {
+			*compensated = append(*compensated, name)
+			return nil
+		})
+	}
+
+	return NewDefinition(opts...).
+		On("new", "reserve", "reserved", step("release"), TransitionActionOption(setValueAction("reserved"))).
+		On("reserved", "charge", "charged", step("refund")).
+		When("charged", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			Compensate(eventCtx, func(eventCtx EventContext) error {
+				*compensated = append(*compensated, "cancel shipping")
+				return nil
+			})
+			return "", nil, errors.New("shipping failed")
+		})
+}
+
+func TestFsm_Compensations(t *testing.T) {
+	t.Run("Batch", func(t *testing.T) {
+		var compensated []string
+		fsm, err := newSagaDefinition(&compensated).NewInstance("new")
+		assert.NoError(t, err)
+		ctx := fsm.ctx
+		notifications, cancel := fsm.Subscribe(nil)
+		defer cancel()
+
+		err = fsm.ProcessBatch([]Event{"reserve", "charge", "ship"}, nil)
+		assert.EqualError(t, err, "transition from [charged] on event [ship] failed: shipping failed")
+		assert.Equal(t, []string{"cancel shipping", "refund", "release"}, compensated)
+		assert.Equal(t, "new", fsm.CurrentState())
+		assert.Equal(t, ctx, fsm.ctx)
+		assert.Len(t, notifications, 0)
+
+		compensated = nil
+		assert.NoError(t, fsm.ProcessBatch([]Event{"reserve", "charge"}, nil))
+		assert.Empty(t, compensated)
+		assert.Equal(t, "charged", fsm.CurrentState())
+		assert.Len(t, notifications, 2)
+	})
+
+	t.Run("Pre-commit function", func(t *testing.T) {
+		var compensated []string
+		preCommitErr := errors.New("limit exceeded")
+		fsm, err := newSagaDefinition(&compensated).
+			RegisterPreCommitFunc("*", "charged", func(from, to State, fsmCtx FsmContext) error {
+				assert.Equal(t, "reserved", fsmCtx.Value(testCtxKey("value")))
+				return preCommitErr
+			}).
+			NewInstance("new")
+		assert.NoError(t, err)
+
+		assert.NoError(t, fsm.ProcessEvent("reserve", nil))
+		err = fsm.ProcessEvent("charge", nil)
+		assert.True(t, errors.Is(err, preCommitErr))
+		assert.Equal(t, []string{"refund"}, compensated)
+		assert.Equal(t, "reserved", fsm.CurrentState())
+	})
+
+	t.Run("Pre-commit function panic", func(t *testing.T) {
+		var compensated []string
+		fsm, err := newSagaDefinition(&compensated).
+			RegisterPreCommitFunc("new", "*", func(from, to State, fsmCtx FsmContext) error {
+				panic("boom")
+			}).
+			NewInstance("new")
+		assert.NoError(t, err)
+
+		var panicErr *PanicError
+		assert.True(t, errors.As(fsm.ProcessEvent("reserve", nil), &panicErr))
+		assert.Equal(t, []string{"release"}, compensated)
+		assert.Equal(t, "new", fsm.CurrentState())
+	})
+
+	t.Run("Persistence", func(t *testing.T) {
+		var compensated []string
+		store := &failingStore{MemoryStore: NewMemoryStore()}
+		fsm, err := newSagaDefinition(&compensated, PersistOption(store, nil)).NewInstance("new", InstanceIDOption("order"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, fsm.ProcessEvent("reserve", nil))
+		snapshot, err := store.Load(context.Background(), "order")
+		assert.NoError(t, err)
+		assert.Equal(t, "reserved", snapshot.State)
+
+		store.err = errors.New("store is unavailable")
+		err = fsm.ProcessEvent("charge", nil)
+		assert.EqualError(t, err, "transition from [reserved] to [charged] on event [charge] failed: store is unavailable")
+		assert.Equal(t, []string{"refund"}, compensated)
+		assert.Equal(t, "reserved", fsm.CurrentState())
+	})
+
+	t.Run("Failed compensation", func(t *testing.T) {
+		compensationErr := errors.New("refund failed")
+		fsm, err := NewFsm().
+			On("new", "charge", "charged", CompensationOption(func(eventCtx EventContext) error {
+				return compensationErr
+			})).
+			Final("charged").
+			RegisterPreCommitFunc("*", "*", func(from, to State, fsmCtx FsmContext) error {
+				return errors.New("rejected")
+			}).
+			InitWithState("new")
+		assert.NoError(t, err)
+
+		err = fsm.ProcessEvent("charge", nil)
+		var compensationError *CompensationError
+		if assert.True(t, errors.As(err, &compensationError)) {
+			assert.Equal(t, []error{compensationErr}, compensationError.Errors)
+		}
+		assert.EqualError(t, err, "transition from [new] to [charged] on event [charge] failed: rejected (compensation failed: refund failed)")
+	})
+
+	t.Run("Outside of event processing", func(t *testing.T) {
+		assert.False(t, Compensate(context.Background(), func(eventCtx EventContext) error {
+			return nil
+		}))
+	})
+}
@@ -0,0 +1,498 @@
+package go_fsm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Definition describes FSM behaviour: states with their action functions and post transition functions.
+// It is built once and shared by all instances created with NewInstance, instances hold only
+// their state, context and lifecycle. The definition is validated and frozen by the first NewInstance call:
+// builder methods panic with ErrDefinitionFrozen after that, so an instance can't change the behaviour of others.
+// Runtime changes (ReplaceAction, AddPreCommitFunc, AddPostTransitionFunc and Unregister) are safe for concurrent
+// use, they create a new immutable snapshot (copy on write) and each event is processed by a single snapshot.
+// A definition of FSM created by NewFsm is owned by the instance and it isn't frozen.
+type Definition struct {
+	mu       sync.Mutex
+	snapshot atomic.Value
+	// an instance is started, so the snapshot is read by events and it's modified by a copy
+	published bool
+	// builder methods are rejected
+	frozen bool
+
+	options Options
+	logger  StructuredLogger
+	metrics Metrics
+	tracer  Tracer
+}
+
+// immutable part of the definition which is used during event processing
+type definitionSnapshot struct {
+	actionMap map[State]ActionFunc
+	// all-state event handlers
+	anyStateActionMap map[Event]ActionFunc
+	// handler of events which are not handled by the state and all-state handlers
+	unhandledAction ActionFunc
+	// declarative transitions in order of registration and their index
+	transitions           []Transition
+	transitionMap         map[eventKey][]Transition
+	preCommitFuncMap      map[transitionKey][]*HookRegistration
+	postTransitionFuncMap map[transitionKey][]*HookRegistration
+	// functions which are called when a state is entered or exited by an external transition
+	entryFuncMap map[State][]TransitionFunc
+	exitFuncMap  map[State][]TransitionFunc
+	timeoutMap            map[State]stateTimeout
+	finalStates           map[State]bool
+	terminateFuncs        []TerminateFunc
+	// states which are registered only as targets of declarative transitions
+	implicitStates map[State]bool
+	// states which action functions can return (see TargetsOption), action functions without targets are opaque
+	stateTargets     map[State][]State
+	anyStateTargets  map[Event][]State
+	unhandledTargets []State
+}
+
+// InstanceOption configures a single FSM instance created from the definition
+type InstanceOption func(*instanceOptions)
+
+type instanceOptions struct {
+	id string
+}
+
+// InstanceIDOption set ID of the instance (generated if empty)
+func InstanceIDOption(id string) InstanceOption {
+	return func(o *instanceOptions) {
+		o.id = id
+	}
+}
+
+// NewDefinition create an empty FSM definition
+func NewDefinition(opts ...Option) *Definition {
+	options := newOptions(opts...)
+
+	def := &Definition{
+		options: options,
+		logger:  options.structuredLogger(),
+		metrics: options.Metrics,
+		tracer:  options.Tracer,
+	}
+	def.snapshot.Store(&definitionSnapshot{
+		actionMap:             map[State]ActionFunc{},
+		anyStateActionMap:     map[Event]ActionFunc{},
+		transitionMap:         map[eventKey][]Transition{},
+		preCommitFuncMap:      map[transitionKey][]*HookRegistration{},
+		postTransitionFuncMap: map[transitionKey][]*HookRegistration{},
+		timeoutMap:            map[State]stateTimeout{},
+		finalStates:           map[State]bool{},
+		implicitStates:        map[State]bool{},
+		entryFuncMap:          map[State][]TransitionFunc{},
+		exitFuncMap:           map[State][]TransitionFunc{},
+		stateTargets:          map[State][]State{},
+		anyStateTargets:       map[Event][]State{},
+	})
+
+	return def
+}
+
+// ActionOption configures an action function registered by When, WhenAny or WhenUnhandled
+type ActionOption func(*actionOptions)
+
+type actionOptions struct {
+	// nil if targets are not declared
+	targets []State
+}
+
+// TargetsOption declare all states which the action function can return, so Validate sees its transitions
+// instead of treating the function as opaque. A transition to another state fails with ErrUnknownNextState.
+func TargetsOption(states ...State) ActionOption {
+	return func(o *actionOptions) {
+		o.targets = append(append([]State{}, o.targets...), states...)
+	}
+}
+
+// declared targets of the action function, nil if they're not declared
+func actionTargets(opts []ActionOption) []State {
+	var options actionOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	return options.targets
+}
+
+// action function which fails if the next state is not one of the declared targets
+func restrictTargets(action ActionFunc, targets []State) ActionFunc {
+	if action == nil || targets == nil {
+		return action
+	}
+	return func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+		next, nextFsmCtx, err = action(eventCtx, fsmCtx)
+		if err == nil && !containsState(targets, next) {
+			return next, nextFsmCtx, fmt.Errorf("%w: [%s] is not a target of the action function", ErrUnknownNextState, next)
+		}
+		return next, nextFsmCtx, err
+	}
+}
+
+func containsState(states []State, state State) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+//When set action function for the state, it can't be called after NewInstance: use ReplaceAction
+//to change the action function of a running definition
+func (def *Definition) When(state State, action ActionFunc, opts ...ActionOption) *Definition {
+	targets := actionTargets(opts)
+	def.update("When", func(s *definitionSnapshot) {
+		s.actionMap[state] = restrictTargets(action, targets)
+		if targets != nil {
+			s.stateTargets[state] = targets
+		} else {
+			delete(s.stateTargets, state)
+		}
+		delete(s.implicitStates, state)
+	})
+	def.logger.Debug("Action function added", Field{Key: FieldState, Value: state})
+	return def
+}
+
+//ReplaceAction replace action function of the registered state atomically, it's safe to call concurrently
+//with event processing: an event which is being processed uses the previous function, the following events use the new one.
+//Targets declared for the state action (see TargetsOption) apply to the new function.
+func (def *Definition) ReplaceAction(state State, action ActionFunc) error {
+	var err error
+	def.swap(func(s *definitionSnapshot) {
+		if !s.isStateExists(state) {
+			err = fmt.Errorf("%w [%s]", ErrUnknownState, state)
+			return
+		}
+		s.actionMap[state] = restrictTargets(action, s.stateTargets[state])
+	})
+	if err != nil {
+		return err
+	}
+	def.logger.Debug("Action function replaced", Field{Key: FieldState, Value: state})
+	return nil
+}
+
+//On add a declarative transition from the state to another state on the event, both states are registered
+//(until the target state is registered by When, Final or as a source of a transition, it's reported by Validate
+//and the transition fails with ErrUnknownNextState).
+//Transitions of the state are tried in order of registration before the state action function,
+//the first transition allowed by its guard is performed.
+func (def *Definition) On(from State, event Event, to State, opts ...TransitionOption) *Definition {
+	t := Transition{From: from, Event: event, To: to}
+	for _, o := range opts {
+		o(&t)
+	}
+
+	key := eventKey{state: from, event: event}
+	def.update("On", func(s *definitionSnapshot) {
+		s.registerState(from, false)
+		s.registerState(to, true)
+		// never append in place, backing arrays are shared with the previous snapshot
+		s.transitions = append(s.transitions[:len(s.transitions):len(s.transitions)], t)
+		transitions := s.transitionMap[key]
+		s.transitionMap[key] = append(transitions[:len(transitions):len(transitions)], t)
+	})
+	def.logger.Debug("Transition added",
+		Field{Key: FieldState, Value: from},
+		Field{Key: FieldEvent, Value: event},
+		Field{Key: FieldNextState, Value: to},
+	)
+	return def
+}
+
+//WhenAny set action function for the event in all states,
+//it's called when the state action returns ErrNotHandled (or the state has no action function)
+func (def *Definition) WhenAny(event Event, action ActionFunc, opts ...ActionOption) *Definition {
+	targets := actionTargets(opts)
+	def.update("WhenAny", func(s *definitionSnapshot) {
+		s.anyStateActionMap[event] = restrictTargets(action, targets)
+		if targets != nil {
+			s.anyStateTargets[event] = targets
+		} else {
+			delete(s.anyStateTargets, event)
+		}
+	})
+	def.logger.Debug("All-state action function added", Field{Key: FieldEvent, Value: event})
+	return def
+}
+
+//WhenUnhandled set action function for events which are not handled neither by the state action
+//nor by the all-state action of the event
+func (def *Definition) WhenUnhandled(action ActionFunc, opts ...ActionOption) *Definition {
+	targets := actionTargets(opts)
+	def.update("WhenUnhandled", func(s *definitionSnapshot) {
+		s.unhandledAction = restrictTargets(action, targets)
+		s.unhandledTargets = targets
+	})
+	def.logger.Debug("Unhandled event action function added")
+	return def
+}
+
+//RegisterPreCommitFunc add a function which is called synchronously before the transition is committed,
+//an error rejects the transition and rolls back the transaction (see Compensate). "*" matches any state.
+func (def *Definition) RegisterPreCommitFunc(fromState, toState State, fn TransitionFunc) *Definition {
+	def.update("RegisterPreCommitFunc", def.newHook(HookPreCommit, fromState, toState, fn).add)
+	return def
+}
+
+//RegisterPostTransitionFunc add a transition function.
+//
+//Deprecated: use AddPostTransitionFunc, which can be called at runtime and returns a handle to unregister
+//the function. RegisterPostTransitionFunc is kept because it returns the definition for chaining.
+func (def *Definition) RegisterPostTransitionFunc(fromState, toState State, fn TransitionFunc) *Definition {
+	def.update("RegisterPostTransitionFunc", def.newHook(HookPostTransition, fromState, toState, fn).add)
+	return def
+}
+
+//OnEnter add a function which is called synchronously when the state is entered by an external transition
+//(including an external self-transition), it's not called when FSM is initialized or restored in the state.
+//Exit functions of the previous state are called before entry functions, both are called before pre-commit functions.
+//An error rejects the transition and rolls back the transaction, the function can register compensations
+//with the FSM context it receives (see Compensate).
+func (def *Definition) OnEnter(state State, fn TransitionFunc) *Definition {
+	def.update("OnEnter", func(s *definitionSnapshot) {
+		fns := s.entryFuncMap[state]
+		s.entryFuncMap[state] = append(fns[:len(fns):len(fns)], fn)
+	})
+	return def
+}
+
+//OnExit add a function which is called synchronously when the state is exited by an external transition
+//(including an external self-transition), see OnEnter
+func (def *Definition) OnExit(state State, fn TransitionFunc) *Definition {
+	def.update("OnExit", func(s *definitionSnapshot) {
+		fns := s.exitFuncMap[state]
+		s.exitFuncMap[state] = append(fns[:len(fns):len(fns)], fn)
+	})
+	return def
+}
+
+//NewInstance create FSM instance initialized with the state, the first call validates and freezes the definition
+func (def *Definition) NewInstance(initialState State, opts ...InstanceOption) (*Fsm, error) {
+	options := instanceOptions{}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if err := def.validateInitialState(initialState); err != nil {
+		return nil, err
+	}
+	if err := def.freeze(); err != nil {
+		return nil, err
+	}
+	return def.newFsm(options.id).InitWithState(initialState)
+}
+
+// create not initialized FSM instance
+func (def *Definition) newFsm(id string) *Fsm {
+	if id == "" {
+		id = newFsmID()
+	}
+
+	return &Fsm{
+		def:         def,
+		id:          id,
+		logger:      withFields(def.logger, Field{Key: FieldFsmID, Value: id}),
+		subscribers: newSubscribers(def.options.SubscriptionBuffer),
+		done:        newDoneChannel(),
+	}
+}
+
+// validate that instance can be started with the state
+func (def *Definition) validateInitialState(state State) error {
+	if !def.load().isStateExists(state) {
+		return fmt.Errorf("invalid initial state [%s]", state)
+	}
+	return nil
+}
+
+// load current snapshot
+func (def *Definition) load() *definitionSnapshot {
+	return def.snapshot.Load().(*definitionSnapshot)
+}
+
+// modify the definition by the builder method, a frozen definition rejects it
+func (def *Definition) update(method string, fn func(s *definitionSnapshot)) {
+	def.mu.Lock()
+	defer def.mu.Unlock()
+
+	if def.frozen {
+		if alternative, ok := runtimeAlternatives[method]; ok {
+			panic(fmt.Errorf("%w: %s can't be called after NewInstance, use %s to change the definition at runtime",
+				ErrDefinitionFrozen, method, alternative))
+		}
+		panic(fmt.Errorf("%w: %s can't be called after NewInstance", ErrDefinitionFrozen, method))
+	}
+	def.modify(fn)
+}
+
+// builder methods which have runtime counterparts, they're suggested by the frozen definition panic
+var runtimeAlternatives = map[string]string{
+	"When":                       "ReplaceAction",
+	"RegisterPreCommitFunc":      "AddPreCommitFunc",
+	"RegisterPostTransitionFunc": "AddPostTransitionFunc",
+}
+
+// modify the definition at runtime
+func (def *Definition) swap(fn func(s *definitionSnapshot)) {
+	def.mu.Lock()
+	defer def.mu.Unlock()
+
+	def.modify(fn)
+}
+
+// modify the snapshot in place while it's built, a published snapshot is modified by a copy which replaces it
+// when it's ready (events which are being processed keep the previous snapshot), the caller holds the lock
+func (def *Definition) modify(fn func(s *definitionSnapshot)) {
+	if !def.published {
+		fn(def.load())
+		return
+	}
+	s := def.load().clone()
+	fn(s)
+	def.snapshot.Store(s)
+}
+
+// mark the snapshot as read by events
+func (def *Definition) publish() {
+	def.mu.Lock()
+	defer def.mu.Unlock()
+
+	def.published = true
+}
+
+// validate and freeze the shared definition, problems are logged,
+// with StrictValidationOption they are returned as ValidationError and the definition stays unfrozen
+func (def *Definition) freeze() error {
+	def.mu.Lock()
+	defer def.mu.Unlock()
+
+	if def.frozen {
+		return nil
+	}
+	if err := def.Validate("").Err(); err != nil {
+		if def.options.StrictValidation {
+			return err
+		}
+		def.logger.Warn("Definition has problems", Field{Key: FieldError, Value: err})
+	}
+	def.frozen, def.published = true, true
+	return nil
+}
+
+func (s *definitionSnapshot) clone() *definitionSnapshot {
+	c := &definitionSnapshot{
+		actionMap:             make(map[State]ActionFunc, len(s.actionMap)),
+		anyStateActionMap:     make(map[Event]ActionFunc, len(s.anyStateActionMap)),
+		unhandledAction:       s.unhandledAction,
+		transitions:           s.transitions,
+		transitionMap:         make(map[eventKey][]Transition, len(s.transitionMap)),
+		preCommitFuncMap:      make(map[transitionKey][]*HookRegistration, len(s.preCommitFuncMap)),
+		postTransitionFuncMap: make(map[transitionKey][]*HookRegistration, len(s.postTransitionFuncMap)),
+		timeoutMap:            make(map[State]stateTimeout, len(s.timeoutMap)),
+		finalStates:           make(map[State]bool, len(s.finalStates)),
+		implicitStates:        make(map[State]bool, len(s.implicitStates)),
+		terminateFuncs:        s.terminateFuncs,
+		entryFuncMap:          make(map[State][]TransitionFunc, len(s.entryFuncMap)),
+		exitFuncMap:           make(map[State][]TransitionFunc, len(s.exitFuncMap)),
+		stateTargets:          make(map[State][]State, len(s.stateTargets)),
+		anyStateTargets:       make(map[Event][]State, len(s.anyStateTargets)),
+		unhandledTargets:      s.unhandledTargets,
+	}
+	for state, targets := range s.stateTargets {
+		c.stateTargets[state] = targets
+	}
+	for event, targets := range s.anyStateTargets {
+		c.anyStateTargets[event] = targets
+	}
+	for state, fns := range s.entryFuncMap {
+		c.entryFuncMap[state] = fns
+	}
+	for state, fns := range s.exitFuncMap {
+		c.exitFuncMap[state] = fns
+	}
+	for state, action := range s.actionMap {
+		c.actionMap[state] = action
+	}
+	for event, action := range s.anyStateActionMap {
+		c.anyStateActionMap[event] = action
+	}
+	for key, transitions := range s.transitionMap {
+		c.transitionMap[key] = transitions
+	}
+	for key, fns := range s.preCommitFuncMap {
+		c.preCommitFuncMap[key] = fns
+	}
+	for key, fns := range s.postTransitionFuncMap {
+		c.postTransitionFuncMap[key] = fns
+	}
+	for state, timeout := range s.timeoutMap {
+		c.timeoutMap[state] = timeout
+	}
+	for state := range s.finalStates {
+		c.finalStates[state] = true
+	}
+	for state := range s.implicitStates {
+		c.implicitStates[state] = true
+	}
+	return c
+}
+
+// register the state without action function,
+// a state which is only a target of transitions is registered implicitly until it's registered explicitly
+func (s *definitionSnapshot) registerState(state State, implicit bool) {
+	if _, ok := s.actionMap[state]; !ok {
+		s.actionMap[state] = nil
+		if implicit {
+			s.implicitStates[state] = true
+		}
+	}
+	if !implicit {
+		delete(s.implicitStates, state)
+	}
+}
+
+// reports whether the state is registered, a state which is only a target of transitions is unknown
+// (see ValidationReport.UnknownTargets), so a transition to it fails with ErrUnknownNextState
+func (s *definitionSnapshot) isStateExists(state State) bool {
+	_, isset := s.actionMap[state]
+	return isset && !s.implicitStates[state]
+}
+
+// action functions which can handle the event in the state, in order of precedence:
+// declarative transitions, the state action, the all-state action of the event and the unhandled event action
+func (s *definitionSnapshot) actions(state State, event Event) []ActionFunc {
+	actions := make([]ActionFunc, 0, 4)
+	if transitions := s.transitionMap[eventKey{state: state, event: event}]; len(transitions) > 0 {
+		actions = append(actions, transitionsAction(transitions))
+	}
+	if action := s.actionMap[state]; action != nil {
+		actions = append(actions, action)
+	}
+	if action := s.anyStateActionMap[event]; action != nil {
+		actions = append(actions, action)
+	}
+	if s.unhandledAction != nil {
+		actions = append(actions, s.unhandledAction)
+	}
+	return actions
+}
+
+// call action functions one by one until the event is handled
+func callActions(actions []ActionFunc, eventCtx EventContext, fsmCtx FsmContext, state State, event Event) (next State, nextFsmCtx FsmContext, err error) {
+	for _, f := range actions {
+		next, nextFsmCtx, err = callAction(f, eventCtx, fsmCtx, state, event)
+		if !errors.Is(err, ErrNotHandled) {
+			return next, nextFsmCtx, err
+		}
+	}
+	return "", nil, ErrNotHandled
+}
@@ -0,0 +1,234 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefinition_NewInstance(t *testing.T) {
+	def := NewDefinition().
+		When("idle", emptyStateActionFunc("next")).
+		When("next", emptyStateActionFunc("idle"))
+
+	t.Run("Invalid initial state", func(t *testing.T) {
+		_, err := def.NewInstance("unknown")
+		assert.EqualError(t, err, "invalid initial state [unknown]")
+	})
+
+	t.Run("Instances share definition but not state", func(t *testing.T) {
+		a, err := def.NewInstance("idle", InstanceIDOption("a"))
+		assert.NoError(t, err)
+		b, err := def.NewInstance("next")
+		assert.NoError(t, err)
+
+		assert.Equal(t, "a", a.ID())
+		assert.NotEmpty(t, b.ID())
+		assert.Equal(t, def, a.Definition())
+		assert.Equal(t, def, b.Definition())
+
+		assert.NoError(t, a.ProcessEvent("go", nil))
+		assert.Equal(t, "next", a.CurrentState())
+		assert.Equal(t, "next", b.CurrentState())
+	})
+}
+
+func TestDefinition_Concurrency(t *testing.T) {
+	var hooks int32
+	def := NewDefinition().
+		When("idle", emptyStateActionFunc("next")).
+		When("next", emptyStateActionFunc("idle"))
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fsm, err := def.NewInstance("idle", InstanceIDOption(fmt.Sprint(i)))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer fsm.Close()
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, fsm.ProcessEvent("go", context.Background()))
+			}
+		}(i)
+	}
+	// modify definition while events are processed
+	def.AddPostTransitionFunc("*", "*", func(from, to State, fsmCtx FsmContext) error {
+		atomic.AddInt32(&hooks, 1)
+		return nil
+	})
+	wg.Wait()
+
+	assert.Len(t, def.load().postTransitionFuncMap[newTransitionKey("*", "*")], 1)
+}
+
+func TestDefinition_snapshot(t *testing.T) {
+	def := NewDefinition().
+		When("idle", emptyStateActionFunc("idle")).
+		RegisterPostTransitionFunc("idle", "idle", func(from, to State, fsmCtx FsmContext) error {
+			return nil
+		})
+
+	// the definition is modified in place until the first instance is created
+	building := def.load()
+	def.When("next", emptyStateActionFunc("idle"))
+	assert.True(t, building == def.load())
+
+	_, err := def.NewInstance("idle")
+	assert.NoError(t, err)
+
+	// runtime changes of a frozen definition are made by a copy
+	before := def.load()
+	def.AddPostTransitionFunc("idle", "idle", func(from, to State, fsmCtx FsmContext) error {
+		return nil
+	})
+	after := def.load()
+
+	assert.True(t, before.isStateExists("next"))
+	assert.Len(t, before.postTransitionFuncMap[newTransitionKey("idle", "idle")], 1)
+	assert.Len(t, after.postTransitionFuncMap[newTransitionKey("idle", "idle")], 2)
+}
+
+func TestDefinition_freeze(t *testing.T) {
+	t.Run("Builder methods are rejected", func(t *testing.T) {
+		def := NewDefinition().When("idle", emptyStateActionFunc("idle"))
+		fsm, err := def.NewInstance("idle")
+		assert.NoError(t, err)
+
+		assertFrozen := func(method string, call func()) {
+			defer func() {
+				err, _ := recover().(error)
+				assert.True(t, errors.Is(err, ErrDefinitionFrozen), method)
+				expected := "definition is frozen: " + method + " can't be called after NewInstance"
+				if alternative, ok := runtimeAlternatives[method]; ok {
+					expected += ", use " + alternative + " to change the definition at runtime"
+				}
+				assert.EqualError(t, err, expected)
+			}()
+			call()
+		}
+		assertFrozen("When", func() { fsm.When("next", nil) })
+		assertFrozen("On", func() { def.On("idle", "go", "next") })
+		assertFrozen("WhenAny", func() { def.WhenAny("go", nil) })
+		assertFrozen("WhenUnhandled", func() { def.WhenUnhandled(nil) })
+		assertFrozen("Final", func() { def.Final("idle") })
+		assertFrozen("StateTimeout", func() { def.StateTimeout("idle", time.Second, "expire") })
+		assertFrozen("OnTerminate", func() { def.OnTerminate(nil) })
+		assertFrozen("RegisterPreCommitFunc", func() { fsm.RegisterPreCommitFunc("*", "*", nil) })
+		assertFrozen("RegisterPostTransitionFunc", func() { def.RegisterPostTransitionFunc("*", "*", nil) })
+		assertFrozen("OnEnter", func() { fsm.OnEnter("idle", nil) })
+		assertFrozen("OnExit", func() { def.OnExit("idle", nil) })
+		assert.Equal(t, []State{"idle"}, def.States())
+
+		// the panic suggests the runtime counterpart of the builder method
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				assert.EqualError(t, err, "definition is frozen: When can't be called after NewInstance, "+
+					"use ReplaceAction to change the definition at runtime")
+			}()
+			def.When("idle", nil)
+		}()
+	})
+
+	t.Run("Instance of NewFsm owns the definition", func(t *testing.T) {
+		fsm, err := NewFsm().When("idle", emptyStateActionFunc("next")).InitWithState("idle")
+		assert.NoError(t, err)
+		fsm.When("next", emptyStateActionFunc("idle"))
+		assert.NoError(t, fsm.ProcessEvent("go", nil))
+		assert.Equal(t, "next", fsm.CurrentState())
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		logger := &recordingLogger{}
+		def := NewDefinition(StructuredLoggerOption(logger)).On("idle", "go", "missing")
+		_, err := def.NewInstance("idle")
+		assert.NoError(t, err)
+		assert.Contains(t, logger.lines(), `level=WARN msg="Definition has problems" error="invalid definition: `+
+			`transition from [idle] on event [go] targets unregistered state [missing]"`)
+
+		def = NewDefinition(StrictValidationOption()).On("idle", "go", "missing")
+		_, err = def.NewInstance("idle")
+		var validationErr *ValidationError
+		assert.True(t, errors.As(err, &validationErr))
+		// the definition can be fixed
+		def.When("missing", emptyStateActionFunc("idle"))
+		_, err = def.NewInstance("idle")
+		assert.NoError(t, err)
+	})
+}
+
+func TestDefinition_WhenAnyAndWhenUnhandled(t *testing.T) {
+	// action which handles only the event and reports others as not handled
+	onEvent := func(expected Event, nextState State) ActionFunc {
+		return func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			if event, _ := EventFromCtx(eventCtx); event != expected {
+				return "", nil, ErrNotHandled
+			}
+			return nextState, nil, nil
+		}
+	}
+
+	t.Run("Precedence", func(t *testing.T) {
+		var unhandled []Event
+		def := NewDefinition().
+			When("idle", onEvent("start", "running")).
+			When("running", onEvent("shutdown", "idle")).
+			When("stopped", nil).
+			WhenAny("shutdown", emptyStateActionFunc("stopped")).
+			WhenUnhandled(func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+				event, _ := EventFromCtx(eventCtx)
+				unhandled = append(unhandled, event)
+				state, err := StateFromCtx(fsmCtx)
+				return state, nil, err
+			})
+
+		fsm, err := def.NewInstance("idle")
+		assert.NoError(t, err)
+
+		// the state action
+		assert.NoError(t, fsm.ProcessEvent("start", nil))
+		assert.Equal(t, "running", fsm.CurrentState())
+		// the state action takes precedence over the all-state action
+		assert.NoError(t, fsm.ProcessEvent("shutdown", nil))
+		assert.Equal(t, "idle", fsm.CurrentState())
+		// the all-state action
+		assert.NoError(t, fsm.ProcessEvent("shutdown", nil))
+		assert.Equal(t, "stopped", fsm.CurrentState())
+		// the state without action
+		assert.NoError(t, fsm.ProcessEvent("unknown", nil))
+		assert.Equal(t, "stopped", fsm.CurrentState())
+		assert.Equal(t, []Event{"unknown"}, unhandled)
+	})
+
+	t.Run("Not handled", func(t *testing.T) {
+		fsm, err := NewDefinition().
+			When("idle", onEvent("start", "idle")).
+			WhenAny("shutdown", onEvent("never", "idle")).
+			NewInstance("idle")
+		assert.NoError(t, err)
+
+		err = fsm.ProcessEvent("shutdown", nil)
+		assert.True(t, errors.Is(err, ErrNotHandled))
+		assert.EqualError(t, err, "transition from [idle] on event [shutdown] failed: event is not handled")
+	})
+
+	t.Run("No actions", func(t *testing.T) {
+		fsm, err := NewFsm().
+			When("idle", nil).
+			WhenAny("shutdown", emptyStateActionFunc("idle")).
+			InitWithState("idle")
+		assert.NoError(t, err)
+
+		assert.NoError(t, fsm.ProcessEvent("shutdown", nil))
+		assert.True(t, errors.Is(fsm.ProcessEvent("start", nil), ErrActionNotFound))
+	})
+}
@@ -0,0 +1,221 @@
+package go_fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DiagramOptions configures diagram exporters
+type DiagramOptions struct {
+	// name of the diagram ("fsm" by default)
+	Name string
+	// initial state, Fsm exporters use the initial state of the instance
+	InitialState State
+	// separator of hierarchical state names, e.g. "." groups "order.paid" and "order.new" into "order" cluster,
+	// states are not grouped if it's empty
+	HierarchySeparator string
+}
+
+// diagram is a definition model shared by all exporters
+type diagram struct {
+	name        string
+	initial     State
+	states      map[State]diagramState
+	transitions []diagramTransition
+	root        *diagramCluster
+	clusters    map[string]*diagramCluster
+	// identifiers of states and clusters for formats which don't allow arbitrary names
+	ids map[string]string
+}
+
+type diagramState struct {
+	name  State
+	label string
+	final bool
+	// transitions of the state are hidden in its action function
+	opaque bool
+}
+
+type diagramTransition struct {
+	Transition
+	// transition functions called by the transition
+	hooks []string
+	// the transition is a declared target of an action function (see TargetsOption)
+	action bool
+}
+
+// label of the transition: the event, the guard and the internal mark
+func (t diagramTransition) label() string {
+	label := t.Event
+	if t.Guard != nil || t.GuardName != "" {
+		name := t.GuardName
+		if name == "" {
+			name = "guard"
+		}
+		label += " [" + name + "]"
+	}
+	if t.Internal && t.From == t.To {
+		label += " (internal)"
+	}
+	return label
+}
+
+// group of hierarchical states
+type diagramCluster struct {
+	// full name of the cluster, it's empty for the root
+	name     string
+	label    string
+	states   []State
+	children []*diagramCluster
+}
+
+func (def *Definition) diagram(opts DiagramOptions) *diagram {
+	s := def.load()
+	d := &diagram{
+		name:    opts.Name,
+		initial: opts.InitialState,
+		states:  make(map[State]diagramState, len(s.actionMap)),
+		root:    &diagramCluster{},
+	}
+	if d.name == "" {
+		d.name = "fsm"
+	}
+
+	anyOpaque := s.anyOpaque()
+	names := make([]State, 0, len(s.actionMap))
+	for state := range s.actionMap {
+		names = append(names, state)
+		d.states[state] = diagramState{
+			name:   state,
+			label:  state,
+			final:  s.finalStates[state],
+			opaque: anyOpaque || s.isOpaque(state),
+		}
+	}
+	sort.Strings(names)
+
+	clusters := map[string]*diagramCluster{"": d.root}
+	d.clusters = clusters
+	for _, name := range names {
+		cluster := d.root
+		if sep := opts.HierarchySeparator; sep != "" {
+			parts := strings.Split(name, sep)
+			for i := 1; i < len(parts); i++ {
+				path := strings.Join(parts[:i], sep)
+				child, ok := clusters[path]
+				if !ok {
+					child = &diagramCluster{name: path, label: parts[i-1]}
+					clusters[path] = child
+					cluster.children = append(cluster.children, child)
+				}
+				cluster = child
+			}
+			state := d.states[name]
+			state.label = parts[len(parts)-1]
+			d.states[name] = state
+		}
+		cluster.states = append(cluster.states, name)
+	}
+
+	addTransition := func(t Transition, action bool) {
+		dt := diagramTransition{Transition: t, action: action}
+		if !t.Internal || t.From != t.To {
+			dt.hooks = append(dt.hooks, hookLabels("pre", s.preCommitFuncMap, t.From, t.To)...)
+			dt.hooks = append(dt.hooks, hookLabels("post", s.postTransitionFuncMap, t.From, t.To)...)
+		}
+		d.transitions = append(d.transitions, dt)
+	}
+	for _, t := range s.transitions {
+		addTransition(t, false)
+	}
+	// all-state and unhandled event actions can be called in every state which accepts events
+	for _, t := range s.actionTransitions() {
+		if t.From != "*" {
+			addTransition(t, true)
+			continue
+		}
+		for _, name := range names {
+			if !s.finalStates[name] {
+				t.From = name
+				addTransition(t, true)
+			}
+		}
+	}
+
+	d.ids = map[string]string{}
+	used := map[string]bool{}
+	for _, name := range append(names, sortedClusterNames(clusters)...) {
+		if _, ok := d.ids[name]; ok || name == "" {
+			continue
+		}
+		id := diagramID(name)
+		for i := 2; used[id]; i++ {
+			id = fmt.Sprintf("%s_%d", diagramID(name), i)
+		}
+		used[id] = true
+		d.ids[name] = id
+	}
+
+	return d
+}
+
+// guards of transitions from the state
+func (d *diagram) guardNotes(state State) []string {
+	var notes []string
+	for _, t := range d.transitions {
+		if t.From == state && (t.Guard != nil || t.GuardName != "") {
+			notes = append(notes, t.label())
+		}
+	}
+	return notes
+}
+
+// transitions labels without guards which are shown in notes
+func (t diagramTransition) eventLabel() string {
+	label := t.Event
+	if t.Internal && t.From == t.To {
+		label += " (internal)"
+	}
+	return label
+}
+
+func sortedClusterNames(clusters map[string]*diagramCluster) []string {
+	names := make([]string, 0, len(clusters))
+	for name := range clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// identifier which contains only letters, digits and underscores and doesn't start with a digit
+func diagramID(name string) string {
+	id := []rune(name)
+	for i, r := range id {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			id[i] = '_'
+		}
+	}
+	if len(id) > 0 && id[0] >= '0' && id[0] <= '9' {
+		return "_" + string(id)
+	}
+	return string(id)
+}
+
+// labels of transition functions which are called by the transition
+func hookLabels(prefix string, funcMap map[transitionKey][]*HookRegistration, from, to State) []string {
+	var labels []string
+	for _, key := range transitionKeys(from, to) {
+		n := len(funcMap[key])
+		if n == 0 {
+			continue
+		}
+		label := fmt.Sprintf("%s: %s -> %s", prefix, key.from, key.to)
+		if n > 1 {
+			label += fmt.Sprintf(" x%d", n)
+		}
+		labels = append(labels, label)
+	}
+	return labels
+}
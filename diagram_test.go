@@ -0,0 +1,132 @@
+package go_fsm
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// compare the output with the golden file, run tests with -update flag to rewrite golden files
+func assertGolden(t *testing.T, name string, export func(w io.Writer) error) {
+	buf := new(bytes.Buffer)
+	if !assert.NoError(t, export(buf)) {
+		return
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		assert.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+	}
+	expected, err := ioutil.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(expected), buf.String())
+	}
+}
+
+func TestDefinition_ExportStateDiagrams(t *testing.T) {
+	opts := DiagramOptions{Name: "order", InitialState: "order.new", HierarchySeparator: "."}
+	def := newDiagramDefinition()
+
+	t.Run("DOT", func(t *testing.T) {
+		assertGolden(t, "order.dot", func(w io.Writer) error {
+			return def.ExportDOT(w, opts)
+		})
+	})
+
+	t.Run("Mermaid", func(t *testing.T) {
+		assertGolden(t, "order.mmd", func(w io.Writer) error {
+			return def.ExportMermaid(w, opts)
+		})
+	})
+
+	t.Run("PlantUML", func(t *testing.T) {
+		assertGolden(t, "order.puml", func(w io.Writer) error {
+			return def.ExportPlantUML(w, opts)
+		})
+	})
+
+	t.Run("Flat", func(t *testing.T) {
+		fsm, err := NewFsm().
+			On("idle", "go", "running").
+			On("running", "stop", "idle").
+			InitWithState("idle")
+		assert.NoError(t, err)
+
+		assertGolden(t, "flat.mmd", func(w io.Writer) error {
+			return fsm.ExportMermaid(w, DiagramOptions{})
+		})
+		assertGolden(t, "flat.puml", func(w io.Writer) error {
+			return fsm.ExportPlantUML(w, DiagramOptions{})
+		})
+	})
+
+	t.Run("Action targets", func(t *testing.T) {
+		action := emptyStateActionFunc("done")
+		def := NewDefinition().
+			When("idle", action, TargetsOption("running", "done")).
+			When("running", action, TargetsOption("done")).
+			WhenAny("cancel", action, TargetsOption("cancelled")).
+			Final("done", "cancelled").
+			RegisterPostTransitionFunc("idle", "running", func(from, to State, fsmCtx FsmContext) error {
+				return nil
+			})
+		opts := DiagramOptions{Name: "targets", InitialState: "idle"}
+
+		assertGolden(t, "targets.dot", func(w io.Writer) error {
+			return def.ExportDOT(w, opts)
+		})
+		assertGolden(t, "targets.mmd", func(w io.Writer) error {
+			return def.ExportMermaid(w, opts)
+		})
+		assertGolden(t, "targets.puml", func(w io.Writer) error {
+			return def.ExportPlantUML(w, opts)
+		})
+	})
+
+	t.Run("Escaping", func(t *testing.T) {
+		def := NewDefinition().
+			On(`say "hi"`, "a;b", `C:\tmp`, GuardOption("#1", func(eventCtx EventContext, fsmCtx FsmContext) bool {
+				return true
+			})).
+			On(`C:\tmp`, "retry: 1\nthen 2", `say "hi"`, GuardOption(`x\y: z`, func(eventCtx EventContext, fsmCtx FsmContext) bool {
+				return true
+			}))
+
+		buf := new(bytes.Buffer)
+		assert.NoError(t, def.ExportMermaid(buf, DiagramOptions{}))
+		assert.Contains(t, buf.String(), `state "say #quot;hi#quot;" as say__hi_`)
+		assert.Contains(t, buf.String(), `state "C:\tmp" as C__tmp`)
+		assert.Contains(t, buf.String(), `say__hi_ --> C__tmp : a#59;b`)
+		assert.Contains(t, buf.String(), `a#59;b [#35;1]`)
+
+		buf.Reset()
+		assert.NoError(t, def.ExportPlantUML(buf, DiagramOptions{}))
+		assert.Contains(t, buf.String(), `state "say <U+0022>hi<U+0022>" as say__hi_`)
+		assert.Contains(t, buf.String(), `C__tmp --> say__hi_ : retry<U+003A> 1\nthen 2`)
+
+		assertGolden(t, "escaping.mmd", func(w io.Writer) error {
+			return def.ExportMermaid(w, DiagramOptions{})
+		})
+		assertGolden(t, "escaping.puml", func(w io.Writer) error {
+			return def.ExportPlantUML(w, DiagramOptions{})
+		})
+	})
+
+	t.Run("Write error", func(t *testing.T) {
+		assert.EqualError(t, def.ExportMermaid(failingWriter{}, opts), "write error")
+		assert.EqualError(t, def.ExportPlantUML(failingWriter{}, opts), "write error")
+	})
+}
+
+func Test_diagramID(t *testing.T) {
+	assert.Equal(t, "order_payment_paid", diagramID("order.payment.paid"))
+	assert.Equal(t, "_1st_state", diagramID("1st state"))
+	assert.Equal(t, "____", diagramID("стан"))
+}
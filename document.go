@@ -0,0 +1,459 @@
+package go_fsm
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a serializable description of a definition, functions are referenced by names
+// registered in ActionRegistry. JSON documents are read as YAML and use the same keys:
+//
+//	initial: new
+//	states:
+//	  - name: new
+//	    timeout: {after: 30m, event: expire}
+//	  - name: paid
+//	    action: paid
+//	  - name: cancelled
+//	    final: true
+//	transitions:
+//	  - {from: new, event: pay, to: paid, guard: hasFunds, action: charge, compensation: refund}
+//	  - {from: new, event: expire, to: cancelled}
+//	any:
+//	  - {event: ping, action: pong}
+//	unhandled: ignore
+//	hooks:
+//	  - {kind: post_transition, from: "*", to: paid, func: notify}
+//	  - {kind: entry, to: paid, func: reserve}
+//
+// All states must be declared in the states list, an empty or "*" hook state matches any state.
+// Entry functions are bound to the To state and exit functions to the From state (see Definition.OnEnter).
+type Document struct {
+	Initial     State                `yaml:"initial"`
+	States      []DocumentState      `yaml:"states"`
+	Transitions []DocumentTransition `yaml:"transitions"`
+	Any         []DocumentAnyAction  `yaml:"any"`
+	Unhandled   string               `yaml:"unhandled,omitempty"`
+	Hooks       []DocumentHook       `yaml:"hooks,omitempty"`
+	Position    `yaml:"-"`
+}
+
+// DocumentState declares a state with optional action function, timeout and final flag
+type DocumentState struct {
+	Name     State            `yaml:"name"`
+	Action   string           `yaml:"action,omitempty"`
+	Final    bool             `yaml:"final,omitempty"`
+	Timeout  *DocumentTimeout `yaml:"timeout,omitempty"`
+	Position `yaml:"-"`
+}
+
+// DocumentTimeout is a state timeout, After is a duration like "1m30s" (see time.ParseDuration)
+type DocumentTimeout struct {
+	After    string `yaml:"after"`
+	Event    Event  `yaml:"event"`
+	Position `yaml:"-"`
+}
+
+// DocumentTransition is a declarative transition, see Definition.On
+type DocumentTransition struct {
+	From         State  `yaml:"from"`
+	Event        Event  `yaml:"event"`
+	To           State  `yaml:"to"`
+	Guard        string `yaml:"guard,omitempty"`
+	Action       string `yaml:"action,omitempty"`
+	Compensation string `yaml:"compensation,omitempty"`
+	Internal     bool   `yaml:"internal,omitempty"`
+	Position     `yaml:"-"`
+}
+
+// DocumentAnyAction is an all-state action function of the event, see Definition.WhenAny
+type DocumentAnyAction struct {
+	Event    Event  `yaml:"event"`
+	Action   string `yaml:"action"`
+	Position `yaml:"-"`
+}
+
+// DocumentHook binds a transition function to the pair of states, or to the state for entry and exit functions
+type DocumentHook struct {
+	Kind     HookKind `yaml:"kind"`
+	From     State    `yaml:"from,omitempty"`
+	To       State    `yaml:"to,omitempty"`
+	Func     string   `yaml:"func"`
+	Position `yaml:"-"`
+}
+
+// Position is a location of a document element, it's zero if the element is not parsed from a document
+type Position struct {
+	Line   int
+	Column int
+	// positions of field values of the element
+	fields map[string]Position
+}
+
+// position of the field value or of the element itself if the field is absent
+func (p Position) field(name string) Position {
+	if f, ok := p.fields[name]; ok {
+		return f
+	}
+	return Position{Line: p.Line, Column: p.Column}
+}
+
+// DocumentError is a problem of the document at the position
+type DocumentError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *DocumentError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// DocumentErrors is returned when the document can't be parsed or built, it contains all found problems
+type DocumentErrors []*DocumentError
+
+func (e DocumentErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *DocumentErrors) add(pos Position, format string, args ...interface{}) {
+	*e = append(*e, &DocumentError{Line: pos.Line, Column: pos.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+func (doc *Document) UnmarshalYAML(node *yaml.Node) error {
+	type plain Document
+	pos, err := decodeMapping(node, (*plain)(doc), "initial", "states", "transitions", "any", "unhandled", "hooks")
+	doc.Position = pos
+	return err
+}
+
+func (s *DocumentState) UnmarshalYAML(node *yaml.Node) error {
+	type plain DocumentState
+	pos, err := decodeMapping(node, (*plain)(s), "name", "action", "final", "timeout")
+	s.Position = pos
+	return err
+}
+
+func (t *DocumentTimeout) UnmarshalYAML(node *yaml.Node) error {
+	type plain DocumentTimeout
+	pos, err := decodeMapping(node, (*plain)(t), "after", "event")
+	t.Position = pos
+	return err
+}
+
+func (t *DocumentTransition) UnmarshalYAML(node *yaml.Node) error {
+	type plain DocumentTransition
+	pos, err := decodeMapping(node, (*plain)(t), "from", "event", "to", "guard", "action", "compensation", "internal")
+	t.Position = pos
+	return err
+}
+
+func (a *DocumentAnyAction) UnmarshalYAML(node *yaml.Node) error {
+	type plain DocumentAnyAction
+	pos, err := decodeMapping(node, (*plain)(a), "event", "action")
+	a.Position = pos
+	return err
+}
+
+func (h *DocumentHook) UnmarshalYAML(node *yaml.Node) error {
+	type plain DocumentHook
+	pos, err := decodeMapping(node, (*plain)(h), "kind", "from", "to", "func")
+	h.Position = pos
+	return err
+}
+
+// decode the mapping node into the value, unknown fields are rejected and positions of field values are recorded
+func decodeMapping(node *yaml.Node, v interface{}, fields ...string) (Position, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	pos := Position{Line: node.Line, Column: node.Column}
+	if node.Kind != yaml.MappingNode {
+		return pos, &DocumentError{Line: node.Line, Column: node.Column, Message: "expected a mapping with fields: " + strings.Join(fields, ", ")}
+	}
+
+	pos.fields = make(map[string]Position, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if !containsString(fields, key.Value) {
+			return pos, &DocumentError{
+				Line:    key.Line,
+				Column:  key.Column,
+				Message: fmt.Sprintf("unknown field [%s], expected one of: %s", key.Value, strings.Join(fields, ", ")),
+			}
+		}
+		pos.fields[key.Value] = Position{Line: value.Line, Column: value.Column}
+	}
+
+	return pos, node.Decode(v)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// convert an error of the YAML parser, its messages carry line numbers
+func documentErrorOf(err error) error {
+	var messages []string
+	switch e := err.(type) {
+	case *DocumentError:
+		return DocumentErrors{e}
+	case *yaml.TypeError:
+		messages = e.Errors
+	default:
+		messages = []string{err.Error()}
+	}
+
+	errs := make(DocumentErrors, 0, len(messages))
+	for _, message := range messages {
+		message = strings.TrimPrefix(message, "yaml: ")
+		e := &DocumentError{Message: message}
+		if n, _ := fmt.Sscanf(message, "line %d:", &e.Line); n == 1 {
+			e.Message = strings.TrimSpace(message[strings.Index(message, ":")+1:])
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// ParseDocument read the JSON or YAML document and check its structure, function names are not resolved
+func ParseDocument(data []byte) (*Document, error) {
+	doc := &Document{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, documentErrorOf(err)
+	}
+	if errs := doc.validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return doc, nil
+}
+
+// check required fields, timeouts, hook kinds and that all states are declared
+func (doc *Document) validate() DocumentErrors {
+	var errs DocumentErrors
+
+	states := make(map[State]bool, len(doc.States))
+	for _, s := range doc.States {
+		switch {
+		case s.Name == "":
+			errs.add(s.Position, "state name is required")
+		case states[s.Name]:
+			errs.add(s.field("name"), "duplicate state [%s]", s.Name)
+		default:
+			states[s.Name] = true
+		}
+
+		if t := s.Timeout; t != nil {
+			if d, err := time.ParseDuration(t.After); err != nil || d <= 0 {
+				errs.add(t.field("after"), "invalid timeout [%s] of state [%s], expected a positive duration like 30s", t.After, s.Name)
+			}
+			if t.Event == "" {
+				errs.add(t.Position, "timeout event of state [%s] is required", s.Name)
+			}
+		}
+	}
+	checkState := func(pos Position, kind string, state State) {
+		if !states[state] {
+			errs.add(pos, "unknown %s state [%s]", kind, state)
+		}
+	}
+
+	if doc.Initial == "" {
+		errs.add(doc.Position, "initial state is required")
+	} else {
+		checkState(doc.field("initial"), "initial", doc.Initial)
+	}
+
+	for _, t := range doc.Transitions {
+		if t.From == "" || t.Event == "" || t.To == "" {
+			errs.add(t.Position, "transition requires from, event and to fields")
+			continue
+		}
+		checkState(t.field("from"), "source", t.From)
+		checkState(t.field("to"), "target", t.To)
+	}
+
+	for _, a := range doc.Any {
+		if a.Event == "" || a.Action == "" {
+			errs.add(a.Position, "all-state action requires event and action fields")
+		}
+	}
+
+	for _, h := range doc.Hooks {
+		if h.Func == "" {
+			errs.add(h.Position, "hook func is required")
+		}
+		switch h.Kind {
+		case HookEntry:
+			if h.To == "" || h.To == "*" || h.From != "" {
+				errs.add(h.Position, "entry hook requires only the to state")
+			} else {
+				checkState(h.field("to"), "hook", h.To)
+			}
+		case HookExit:
+			if h.From == "" || h.From == "*" || h.To != "" {
+				errs.add(h.Position, "exit hook requires only the from state")
+			} else {
+				checkState(h.field("from"), "hook", h.From)
+			}
+		default:
+			if h.Kind != HookPreCommit && h.Kind != HookPostTransition {
+				errs.add(h.field("kind"), "unknown hook kind [%s], expected %s, %s, %s or %s",
+					h.Kind, HookPreCommit, HookPostTransition, HookEntry, HookExit)
+			}
+			if h.From != "" && h.From != "*" {
+				checkState(h.field("from"), "hook", h.From)
+			}
+			if h.To != "" && h.To != "*" {
+				checkState(h.field("to"), "hook", h.To)
+			}
+		}
+	}
+
+	return errs
+}
+
+// Build create the definition described by the document, functions are resolved by names in the registry.
+// DocumentErrors is returned if the document is invalid or refers to unknown functions.
+func (doc *Document) Build(registry *ActionRegistry, opts ...Option) (*Definition, error) {
+	if registry == nil {
+		registry = NewActionRegistry()
+	}
+	errs := doc.validate()
+	def := NewDefinition(opts...)
+
+	for _, s := range doc.States {
+		var action ActionFunc
+		if s.Action != "" {
+			var ok bool
+			if action, ok = registry.action(s.Action); !ok {
+				errs.add(s.field("action"), "unknown action [%s]", s.Action)
+			}
+		}
+		def.When(s.Name, action)
+		if s.Final {
+			def.Final(s.Name)
+		}
+		if t := s.Timeout; t != nil {
+			d, _ := time.ParseDuration(t.After)
+			def.StateTimeout(s.Name, d, t.Event)
+		}
+	}
+
+	for _, t := range doc.Transitions {
+		var opts []TransitionOption
+		if t.Guard != "" {
+			if guard, ok := registry.guard(t.Guard); ok {
+				opts = append(opts, GuardOption(t.Guard, guard))
+			} else {
+				errs.add(t.field("guard"), "unknown guard [%s]", t.Guard)
+			}
+		}
+		if t.Action != "" {
+			if action, ok := registry.transitionAction(t.Action); ok {
+				opts = append(opts, TransitionActionOption(action))
+			} else {
+				errs.add(t.field("action"), "unknown transition action [%s]", t.Action)
+			}
+		}
+		if t.Compensation != "" {
+			if compensation, ok := registry.compensation(t.Compensation); ok {
+				opts = append(opts, CompensationOption(compensation))
+			} else {
+				errs.add(t.field("compensation"), "unknown compensation [%s]", t.Compensation)
+			}
+		}
+		if t.Internal {
+			opts = append(opts, InternalOption())
+		}
+		def.On(t.From, t.Event, t.To, opts...)
+	}
+
+	for _, a := range doc.Any {
+		if action, ok := registry.action(a.Action); ok {
+			def.WhenAny(a.Event, action)
+		} else if a.Action != "" {
+			errs.add(a.field("action"), "unknown action [%s]", a.Action)
+		}
+	}
+
+	if doc.Unhandled != "" {
+		if action, ok := registry.action(doc.Unhandled); ok {
+			def.WhenUnhandled(action)
+		} else {
+			errs.add(doc.field("unhandled"), "unknown action [%s]", doc.Unhandled)
+		}
+	}
+
+	for _, h := range doc.Hooks {
+		fn, ok := registry.hook(h.Func)
+		if !ok {
+			if h.Func != "" {
+				errs.add(h.field("func"), "unknown hook func [%s]", h.Func)
+			}
+			continue
+		}
+		from, to := anyState(h.From), anyState(h.To)
+		switch h.Kind {
+		case HookPreCommit:
+			def.RegisterPreCommitFunc(from, to, fn)
+		case HookPostTransition:
+			def.RegisterPostTransitionFunc(from, to, fn)
+		case HookEntry:
+			def.OnEnter(h.To, fn)
+		case HookExit:
+			def.OnExit(h.From, fn)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return def, nil
+}
+
+// an empty hook state matches any state
+func anyState(state State) State {
+	if state == "" {
+		return "*"
+	}
+	return state
+}
+
+// LoadDefinition parse the JSON or YAML document (see Document) and build the definition,
+// it returns the initial state declared by the document
+func LoadDefinition(data []byte, registry *ActionRegistry, opts ...Option) (*Definition, State, error) {
+	doc, err := ParseDocument(data)
+	if err != nil {
+		return nil, "", err
+	}
+	def, err := doc.Build(registry, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	return def, doc.Initial, nil
+}
+
+// LoadFsm parse the JSON or YAML document (see Document) and create FSM initialized with its initial state
+func LoadFsm(data []byte, registry *ActionRegistry, opts ...Option) (*Fsm, error) {
+	def, initialState, err := LoadDefinition(data, registry, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return def.newFsm(def.options.ID).InitWithState(initialState)
+}
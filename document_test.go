@@ -0,0 +1,207 @@
+package go_fsm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const orderDocument = `
+initial: new
+states:
+  - name: new
+    timeout: {after: 30m, event: expire}
+  - name: paid
+  - name: shipped
+    action: ship
+  - name: cancelled
+    final: true
+transitions:
+  - {from: new, event: pay, to: paid, guard: hasFunds, action: charge, compensation: refund}
+  - {from: new, event: expire, to: cancelled}
+  - {from: paid, event: note, to: paid, action: charge, internal: true}
+any:
+  - {event: cancel, action: cancel}
+hooks:
+  - {kind: exit, from: new, func: leave}
+  - {kind: entry, to: paid, func: enter}
+  - {kind: post_transition, from: "*", to: paid, func: notify}
+  - {kind: pre_commit, func: audit}
+`
+
+func newOrderRegistry(calls *[]string) *ActionRegistry {
+	return NewActionRegistry().
+		RegisterAction("ship", emptyStateActionFunc("shipped")).
+		RegisterAction("cancel", emptyStateActionFunc("cancelled")).
+		RegisterGuard("hasFunds", func(eventCtx EventContext, fsmCtx FsmContext) bool {
+			return true
+		}).
+		RegisterTransitionAction("charge", setValueAction("charged")).
+		RegisterCompensation("refund", func(eventCtx EventContext) error {
+			return nil
+		}).
+		RegisterHook("notify", func(from, to State, fsmCtx FsmContext) error {
+			*calls = append(*calls, "notify "+to)
+			return nil
+		}).
+		RegisterHook("audit", func(from, to State, fsmCtx FsmContext) error {
+			*calls = append(*calls, "audit "+to)
+			return nil
+		}).
+		RegisterHook("leave", func(from, to State, fsmCtx FsmContext) error {
+			*calls = append(*calls, "leave "+from)
+			return nil
+		}).
+		RegisterHook("enter", func(from, to State, fsmCtx FsmContext) error {
+			*calls = append(*calls, "enter "+to)
+			return nil
+		})
+}
+
+func TestLoadFsm(t *testing.T) {
+	var calls []string
+	fsm, err := LoadFsm([]byte(orderDocument), newOrderRegistry(&calls), IDOption("order"))
+	assert.NoError(t, err)
+	assert.Equal(t, "order", fsm.ID())
+	assert.Equal(t, "new", fsm.CurrentState())
+	event, _, ok := fsm.Timeout()
+	assert.True(t, ok)
+	assert.Equal(t, "expire", event)
+	assert.True(t, fsm.Validate().Valid())
+
+	assert.NoError(t, fsm.ProcessEvent("pay", nil))
+	assert.Equal(t, "paid", fsm.CurrentState())
+	assert.Equal(t, "charged", fsm.ctx.Value(testCtxKey("value")))
+	assert.Equal(t, []string{"leave new", "enter paid", "audit paid", "notify paid"}, calls)
+
+	// internal transition doesn't call hooks
+	assert.NoError(t, fsm.ProcessEvent("note", nil))
+	assert.Len(t, calls, 4)
+
+	assert.NoError(t, fsm.ProcessEvent("cancel", nil))
+	<-fsm.Done()
+	assert.Equal(t, StatusTerminated, fsm.Status())
+}
+
+func TestLoadDefinition_JSON(t *testing.T) {
+	def, initial, err := LoadDefinition([]byte(`{
+	"initial": "idle",
+	"states": [{"name": "idle"}, {"name": "running", "timeout": {"after": "1s", "event": "stop"}}],
+	"transitions": [{"from": "idle", "event": "start", "to": "running"}],
+	"unhandled": "ignore"
+}`), NewActionRegistry().RegisterAction("ignore", emptyStateActionFunc("idle")))
+	assert.NoError(t, err)
+	assert.Equal(t, "idle", initial)
+	assert.Equal(t, stateTimeout{duration: time.Second, event: "stop"}, def.load().timeoutMap["running"])
+
+	fsm, err := def.NewInstance(initial)
+	assert.NoError(t, err)
+	assert.NoError(t, fsm.ProcessEvent("start", nil))
+	assert.NoError(t, fsm.ProcessEvent("unknown", nil))
+	assert.Equal(t, "idle", fsm.CurrentState())
+}
+
+func TestLoadDefinition_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		errors   string
+	}{
+		{
+			name:     "Syntax",
+			document: "initial: new\nstates:\n\t- name: new\n",
+			errors:   "line 3: found character that cannot start any token",
+		},
+		{
+			name:     "Duplicate field",
+			document: "initial: new\ninitial: old\n",
+			errors:   "line 2: mapping key \"initial\" already defined at line 1",
+		},
+		{
+			name:     "Unknown field",
+			document: "initial: new\nstates:\n  - name: new\n    finale: true\n",
+			errors:   "line 4: unknown field [finale], expected one of: name, action, final, timeout",
+		},
+		{
+			name:     "Wrong type",
+			document: "initial: new\nstates:\n  - name: new\n    final: maybe\n",
+			errors:   "line 4: cannot unmarshal !!str `maybe` into bool",
+		},
+		{
+			name:     "Not a mapping",
+			document: "initial: new\nstates:\n  - new\n",
+			errors:   "line 3: expected a mapping with fields: name, action, final, timeout",
+		},
+		{
+			name: "Structure",
+			document: `initial: started
+states:
+  - name: new
+    timeout: {after: soon}
+  - name: new
+transitions:
+  - {from: new, event: go, to: done}
+  - {from: new, to: new}
+hooks:
+  - {kind: post, from: gone, func: notify}
+  - {kind: entry, from: new, to: new, func: notify}
+  - {kind: exit, from: gone, func: notify}
+`,
+			errors: "line 4: invalid timeout [soon] of state [new], expected a positive duration like 30s; " +
+				"line 4: timeout event of state [new] is required; " +
+				"line 5: duplicate state [new]; " +
+				"line 1: unknown initial state [started]; " +
+				"line 7: unknown target state [done]; " +
+				"line 8: transition requires from, event and to fields; " +
+				"line 10: unknown hook kind [post], expected pre_commit, post_transition, entry or exit; " +
+				"line 10: unknown hook state [gone]; " +
+				"line 11: entry hook requires only the to state; " +
+				"line 12: unknown hook state [gone]",
+		},
+		{
+			name: "Unknown names",
+			document: `initial: new
+states:
+  - {name: new, action: start}
+transitions:
+  - {from: new, event: go, to: new, guard: allowed, action: change, compensation: undo}
+any:
+  - {event: ping, action: pong}
+unhandled: ignore
+hooks:
+  - {kind: pre_commit, func: audit}
+`,
+			errors: "line 3: unknown action [start]; " +
+				"line 5: unknown guard [allowed]; " +
+				"line 5: unknown transition action [change]; " +
+				"line 5: unknown compensation [undo]; " +
+				"line 7: unknown action [pong]; " +
+				"line 8: unknown action [ignore]; " +
+				"line 10: unknown hook func [audit]",
+		},
+		{
+			name:     "Empty",
+			document: "",
+			errors:   "initial state is required",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsm, err := LoadFsm([]byte(test.document), nil)
+			assert.Nil(t, fsm)
+			assert.EqualError(t, err, test.errors)
+
+			var errs DocumentErrors
+			assert.True(t, errors.As(err, &errs))
+		})
+	}
+
+	t.Run("Columns", func(t *testing.T) {
+		_, err := ParseDocument([]byte("initial: new\nstates:\n  - {name: new}\ntransitions:\n  - {from: new, event: go, to: done}\n"))
+		errs := err.(DocumentErrors)
+		assert.Equal(t, &DocumentError{Line: 5, Column: 32, Message: "unknown target state [done]"}, errs[0])
+	})
+}
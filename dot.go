@@ -0,0 +1,84 @@
+package go_fsm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportDOT write Graphviz DOT representation of the definition: states, declarative transitions labeled
+// with events and guards, the initial and final states. Transition functions are annotated on the edges,
+// states which have action functions are dashed because their transitions are not visible,
+// unless the targets of the action are declared: such transitions are dashed edges.
+func (def *Definition) ExportDOT(w io.Writer, opts DiagramOptions) error {
+	d := def.diagram(opts)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "digraph %s {\n", dotQuote(d.name))
+	buf.WriteString("\trankdir=LR;\n")
+	buf.WriteString("\tnode [shape=box, style=rounded];\n")
+	if d.initial != "" {
+		buf.WriteString("\t\"__start\" [shape=point];\n")
+		fmt.Fprintf(buf, "\t\"__start\" -> %s;\n", dotQuote(d.initial))
+	}
+	d.writeDOTCluster(buf, d.root, "\t")
+	for _, t := range d.transitions {
+		lines := t.hooks
+		if label := t.label(); label != "" || len(lines) == 0 {
+			lines = append([]string{label}, lines...)
+		}
+		label := strings.Join(lines, "\n")
+		if t.action {
+			fmt.Fprintf(buf, "\t%s -> %s [label=%s, style=dashed];\n", dotQuote(t.From), dotQuote(t.To), dotQuote(label))
+			continue
+		}
+		fmt.Fprintf(buf, "\t%s -> %s [label=%s];\n", dotQuote(t.From), dotQuote(t.To), dotQuote(label))
+	}
+	buf.WriteString("}\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+//ExportDOT write Graphviz DOT representation of FSM definition starting from the initial state of FSM
+func (fsm *Fsm) ExportDOT(w io.Writer, opts DiagramOptions) error {
+	if opts.InitialState == "" {
+		opts.InitialState = fsm.initialState
+	}
+	return fsm.def.ExportDOT(w, opts)
+}
+
+func (d *diagram) writeDOTCluster(buf *bytes.Buffer, cluster *diagramCluster, indent string) {
+	for _, name := range cluster.states {
+		state := d.states[name]
+		var attrs []string
+		if state.label != name {
+			attrs = append(attrs, "label="+dotQuote(state.label))
+		}
+		if state.final {
+			attrs = append(attrs, "peripheries=2")
+		}
+		if state.opaque {
+			attrs = append(attrs, `style="rounded,dashed"`)
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(buf, "%s%s;\n", indent, dotQuote(name))
+			continue
+		}
+		fmt.Fprintf(buf, "%s%s [%s];\n", indent, dotQuote(name), strings.Join(attrs, ", "))
+	}
+
+	for _, child := range cluster.children {
+		fmt.Fprintf(buf, "%ssubgraph %s {\n", indent, dotQuote("cluster_"+child.name))
+		fmt.Fprintf(buf, "%s\tlabel=%s;\n", indent, dotQuote(child.label))
+		d.writeDOTCluster(buf, child, indent+"\t")
+		fmt.Fprintf(buf, "%s}\n", indent)
+	}
+}
+
+// quote DOT identifier
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,68 @@
+package go_fsm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// definition of an order workflow with hierarchical states which is used by diagram exporters tests
+func newDiagramDefinition() *Definition {
+	hook := func(from, to State, fsmCtx FsmContext) error {
+		return nil
+	}
+	hasFunds := func(eventCtx EventContext, fsmCtx FsmContext) bool {
+		return true
+	}
+
+	return NewDefinition().
+		On("order.new", "pay", "order.payment.pending", GuardOption("hasFunds", hasFunds)).
+		On("order.payment.pending", "confirm", "order.payment.paid").
+		On("order.payment.pending", "retry", "order.payment.pending", InternalOption()).
+		On("order.payment.paid", "ship", "shipped").
+		On("order.new", "cancel", "cancelled").
+		When("cancelled", emptyStateActionFunc("cancelled")).
+		Final("shipped").
+		RegisterPostTransitionFunc("*", "*", hook).
+		RegisterPostTransitionFunc("order.payment.paid", "shipped", hook).
+		RegisterPostTransitionFunc("order.payment.paid", "shipped", hook).
+		RegisterPreCommitFunc("order.new", "*", hook)
+}
+
+func TestDefinition_ExportDOT(t *testing.T) {
+	t.Run("Flat", func(t *testing.T) {
+		fsm, err := NewFsm().
+			On("idle", "go", "running").
+			On("running", "stop", `say "bye"`).
+			Final(`say "bye"`).
+			InitWithState("idle")
+		assert.NoError(t, err)
+
+		buf := new(bytes.Buffer)
+		assert.NoError(t, fsm.ExportDOT(buf, DiagramOptions{}))
+		assert.Equal(t, `digraph "fsm" {
+	rankdir=LR;
+	node [shape=box, style=rounded];
+	"__start" [shape=point];
+	"__start" -> "idle";
+	"idle";
+	"running";
+	"say \"bye\"" [peripheries=2];
+	"idle" -> "running" [label="go"];
+	"running" -> "say \"bye\"" [label="stop"];
+}
+`, buf.String())
+	})
+
+	t.Run("Write error", func(t *testing.T) {
+		assert.EqualError(t, NewDefinition().ExportDOT(failingWriter{}, DiagramOptions{}), "write error")
+	})
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write error")
+}
@@ -0,0 +1,61 @@
+package go_fsm
+
+import "context"
+
+type ctxDryRunKey int
+
+var dryRunCtxKey ctxDryRunKey
+
+func ctxWithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunCtxKey, true)
+}
+
+// IsDryRun reports whether the event is evaluated by Peek or CanProcess,
+// action functions should skip side effects in this case
+func IsDryRun(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunCtxKey).(bool)
+	return dryRun
+}
+
+// Peek evaluate the event without changing FSM and return the next state. Guards of declarative transitions
+// are evaluated, but their actions and compensations are not called. Action functions are called with the event
+// context marked as dry run (see IsDryRun), their context changes are discarded. Errors of the evaluation are
+// the same as ProcessEvent returns, subscribers and metrics are not notified.
+//
+// Transition functions are not called: exit, entry and pre-commit functions may have side effects and can't be
+// evaluated without them, so an event which they would reject is reported as accepted and ProcessEvent can still fail.
+func (fsm *Fsm) Peek(event Event, eventCtx EventContext) (next State, err error) {
+	def := fsm.def.load()
+	fail := func(next State, err error) (State, error) {
+		return "", fsm.transitionError(event, next, err)
+	}
+
+	if err := fsm.checkAccepting(def); err != nil {
+		return fail("", err)
+	}
+	actions := def.actions(fsm.state, event)
+	if len(actions) == 0 {
+		return fail("", ErrActionNotFound)
+	}
+
+	eventCtx = ctxWithDryRun(ctxWithEvent(checkAndFixEmptyContext(eventCtx), event))
+	if err := checkErrors(fsm.ctx.Err(), eventCtx.Err()); err != nil {
+		return fail("", err)
+	}
+	next, _, err = callActions(actions, eventCtx, ctxWithState(fsm.ctx, fsm.state), fsm.state, event)
+	if err != nil {
+		return fail("", err)
+	}
+	if !def.isStateExists(next) {
+		return fail(next, ErrUnknownNextState)
+	}
+
+	return next, nil
+}
+
+// CanProcess reports whether the event can be processed in the current state, it's evaluated by Peek
+// (transition functions which can reject the event are not called)
+func (fsm *Fsm) CanProcess(event Event, eventCtx EventContext) bool {
+	_, err := fsm.Peek(event, eventCtx)
+	return err == nil
+}
@@ -0,0 +1,126 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsm_Peek(t *testing.T) {
+	var calls []string
+	fsm, err := NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (State, FsmContext, error) {
+			if event, _ := EventFromCtx(eventCtx); event == "jump" {
+				return "nowhere", fsmCtx, nil
+			}
+			if !IsDryRun(eventCtx) {
+				calls = append(calls, "action")
+			}
+			return "stopped", fsmCtx, nil
+		}).
+		When("stopped", nil).
+		When("running", nil).
+		On("idle", "go", "running",
+			GuardOption("always", func(eventCtx EventContext, fsmCtx FsmContext) bool {
+				calls = append(calls, "guard")
+				return true
+			}),
+			TransitionActionOption(func(eventCtx EventContext, fsmCtx FsmContext) (FsmContext, error) {
+				calls = append(calls, "transition action")
+				return fsmCtx, nil
+			}),
+			CompensationOption(func(eventCtx EventContext) error {
+				calls = append(calls, "compensation")
+				return nil
+			})).
+		RegisterPreCommitFunc("*", "*", func(from, to State, fsmCtx FsmContext) error {
+			calls = append(calls, "pre commit")
+			return nil
+		}).
+		RegisterPostTransitionFunc("*", "*", func(from, to State, fsmCtx FsmContext) error {
+			calls = append(calls, "post transition")
+			return nil
+		}).
+		NewInstance("idle")
+	assert.NoError(t, err)
+
+	// the guard is evaluated, actions and hooks are not called
+	next, err := fsm.Peek("go", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "running", next)
+	assert.Equal(t, []string{"guard"}, calls)
+	assert.Equal(t, "idle", fsm.CurrentState())
+
+	// the action function is called in dry-run mode
+	calls = nil
+	next, err = fsm.Peek("stop", context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "stopped", next)
+	assert.Empty(t, calls)
+	assert.True(t, fsm.CanProcess("stop", nil))
+
+	// the same errors as ProcessEvent returns
+	_, err = fsm.Peek("jump", nil)
+	assert.True(t, errors.Is(err, ErrUnknownNextState))
+	assert.Equal(t, &TransitionError{From: "idle", Event: "jump", Next: "nowhere", Cause: ErrUnknownNextState}, err)
+	assert.False(t, fsm.CanProcess("jump", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = fsm.Peek("go", ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	assert.NoError(t, fsm.ProcessEvent("stop", nil))
+	assert.Equal(t, []string{"action", "pre commit", "post transition"}, calls)
+	_, err = fsm.Peek("go", nil)
+	assert.True(t, errors.Is(err, ErrActionNotFound))
+	assert.False(t, fsm.CanProcess("go", nil))
+
+	fsm.Close()
+	_, err = fsm.Peek("go", nil)
+	assert.True(t, errors.Is(err, ErrClosed))
+}
+
+func TestFsm_Peek_Panic(t *testing.T) {
+	fsm, err := newPanickingDefinition().NewInstance("idle")
+	assert.NoError(t, err)
+
+	_, err = fsm.Peek("panic", nil)
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.False(t, fsm.CanProcess("panic", nil))
+	assert.Equal(t, "idle", fsm.CurrentState())
+}
+
+func TestCompensate_DryRun(t *testing.T) {
+	ctx := ctxWithDryRun(ctxWithTransaction(context.Background(), &transaction{}))
+	assert.True(t, IsDryRun(ctx))
+	assert.False(t, IsDryRun(context.Background()))
+	assert.False(t, Compensate(ctx, func(eventCtx EventContext) error { return nil }))
+}
+
+func TestFsm_Peek_TransitionFunctions(t *testing.T) {
+	rejected := errors.New("rejected")
+	fsm, err := NewDefinition().
+		On("idle", "go", "running").
+		On("idle", "touch", "idle", InternalOption()).
+		When("running", nil).
+		RegisterPreCommitFunc("idle", "running", func(from, to State, fsmCtx FsmContext) error {
+			return rejected
+		}).
+		NewInstance("idle")
+	assert.NoError(t, err)
+
+	// pre-commit functions are not evaluated by a dry run
+	assert.True(t, fsm.CanProcess("go", nil))
+	assert.True(t, errors.Is(fsm.ProcessEvent("go", nil), rejected))
+
+	// the internal mark of a declarative transition is kept
+	action := fsm.def.load().actions("idle", "touch")[0]
+	next, nextCtx, err := action(ctxWithDryRun(context.Background()), fsm.ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "idle", next)
+	assert.IsType(t, internalContext{}, nextCtx)
+}
@@ -1,11 +1,25 @@
 package go_fsm
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrActionNotFound     = errors.New("action not found")
+	ErrUnknownNextState   = errors.New("unknown next state")
+	ErrUnknownState       = errors.New("unknown state")
+	ErrNotHandled         = errors.New("event is not handled")
+	ErrClosed             = errors.New("fsm is closed")
+	ErrTerminated         = errors.New("fsm is terminated")
+	ErrNotInitialized     = errors.New("fsm is not initialized")
 	ErrCanNotExtractEvent = errors.New("can't extract event from context")
 	ErrCanNotExtractState = errors.New("can't extract state from context")
+	ErrRegistryClosed     = errors.New("registry is closed")
+	ErrInstanceNotFound   = errors.New("instance not found")
+	ErrSnapshotNotFound   = errors.New("snapshot not found")
+	ErrSupervisorStopped  = errors.New("supervisor is stopped")
+	ErrDefinitionFrozen   = errors.New("definition is frozen")
 )
 
 func checkErrors(errs ...error) error {
@@ -17,3 +31,24 @@ func checkErrors(errs ...error) error {
 
 	return nil
 }
+
+// TransitionError is returned by ProcessEvent when the event can't be processed,
+// use errors.Is to check the cause (e.g. ErrActionNotFound, ErrUnknownNextState, ErrClosed or an action error)
+type TransitionError struct {
+	From  State
+	Event Event
+	// the next state returned by the action, it's empty if the action has not been called or failed
+	Next  State
+	Cause error
+}
+
+func (e *TransitionError) Error() string {
+	if e.Next == "" {
+		return fmt.Sprintf("transition from [%s] on event [%s] failed: %s", e.From, e.Event, e.Cause)
+	}
+	return fmt.Sprintf("transition from [%s] to [%s] on event [%s] failed: %s", e.From, e.Next, e.Event, e.Cause)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Cause
+}
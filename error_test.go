@@ -19,3 +19,19 @@ func Test_checkErrors(t *testing.T) {
 		assert.EqualError(t, err, "second error")
 	})
 }
+
+func TestTransitionError(t *testing.T) {
+	cause := errors.New("action error")
+	err := error(&TransitionError{From: "idle", Event: "go", Cause: cause})
+	assert.EqualError(t, err, "transition from [idle] on event [go] failed: action error")
+	assert.True(t, errors.Is(err, cause))
+
+	err = &TransitionError{From: "idle", Event: "go", Next: "unknown", Cause: ErrUnknownNextState}
+	assert.EqualError(t, err, "transition from [idle] to [unknown] on event [go] failed: unknown next state")
+	assert.True(t, errors.Is(err, ErrUnknownNextState))
+	assert.False(t, errors.Is(err, ErrActionNotFound))
+
+	var transitionErr *TransitionError
+	assert.True(t, errors.As(err, &transitionErr))
+	assert.Equal(t, "unknown", transitionErr.Next)
+}
@@ -0,0 +1,62 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	go_fsm "github.com/igorrius/go-fsm"
+)
+
+type ctxKey string
+
+// Handlers implements the order workflow described by order.yaml
+type Handlers struct {
+	Balance int
+	Price   int
+}
+
+var _ OrderHandlers = (*Handlers)(nil)
+
+func (h *Handlers) Ship(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.State, go_fsm.FsmContext, error) {
+	return "", nil, go_fsm.ErrNotHandled
+}
+
+func (h *Handlers) HasFunds(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) bool {
+	return h.Balance >= h.Price
+}
+
+func (h *Handlers) Charge(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.FsmContext, error) {
+	h.Balance -= h.Price
+	return context.WithValue(fsmCtx, ctxKey("paid"), h.Price), nil
+}
+
+func (h *Handlers) Refund(eventCtx go_fsm.EventContext) error {
+	h.Balance += h.Price
+	return nil
+}
+
+func (h *Handlers) AddNote(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.FsmContext, error) {
+	return context.WithValue(fsmCtx, ctxKey("note"), eventCtx.Value(ctxKey("note"))), nil
+}
+
+func (h *Handlers) Cancel(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.State, go_fsm.FsmContext, error) {
+	return OrderStateCancelled, fsmCtx, nil
+}
+
+func (h *Handlers) CheckLimits(from, to go_fsm.State, fsmCtx go_fsm.FsmContext) error {
+	if h.Balance < 0 {
+		return errors.New("balance limit exceeded")
+	}
+	return nil
+}
+
+func (h *Handlers) Pack(from, to go_fsm.State, fsmCtx go_fsm.FsmContext) error {
+	log.Printf("packing order shipped from [%s]", from)
+	return nil
+}
+
+func (h *Handlers) Notify(from, to go_fsm.State, fsmCtx go_fsm.FsmContext) error {
+	log.Printf("order moved from [%s] to [%s]", from, to)
+	return nil
+}
@@ -0,0 +1,4 @@
+// Package order shows a definition file turned into Go code by fsmgen
+package order
+
+//go:generate go run ../../cmd/fsmgen -type Order order.yaml
@@ -0,0 +1,75 @@
+// Code generated by fsmgen from order.yaml. DO NOT EDIT.
+
+package order
+
+import (
+	"time"
+
+	go_fsm "github.com/igorrius/go-fsm"
+)
+
+// States of Order
+const (
+	OrderStateNew       go_fsm.State = "new"
+	OrderStatePaid      go_fsm.State = "paid"
+	OrderStateShipped   go_fsm.State = "shipped"
+	OrderStateCancelled go_fsm.State = "cancelled"
+)
+
+// Events of Order
+const (
+	OrderEventExpire go_fsm.Event = "expire"
+	OrderEventPay    go_fsm.Event = "pay"
+	OrderEventNote   go_fsm.Event = "note"
+	OrderEventShip   go_fsm.Event = "ship"
+	OrderEventCancel go_fsm.Event = "cancel"
+)
+
+// OrderInitialState is the initial state declared by order.yaml
+const OrderInitialState = OrderStateNew
+
+// OrderHandlers provides functions referenced by order.yaml
+type OrderHandlers interface {
+	// Ship is action function [ship] of state [shipped]
+	Ship(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (next go_fsm.State, nextFsmCtx go_fsm.FsmContext, err error)
+	// HasFunds is guard [hasFunds] of transition [new -> paid] on event [pay]
+	HasFunds(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) bool
+	// Charge is transition action [charge] of transition [new -> paid] on event [pay]
+	Charge(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.FsmContext, error)
+	// Refund is compensation [refund] of transition [new -> paid] on event [pay]
+	Refund(eventCtx go_fsm.EventContext) error
+	// AddNote is transition action [addNote] of transition [paid -> paid] on event [note]
+	AddNote(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.FsmContext, error)
+	// Cancel is action function [cancel] of event [cancel] in all states
+	Cancel(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (next go_fsm.State, nextFsmCtx go_fsm.FsmContext, err error)
+	// CheckLimits is transition function [checkLimits] of pre_commit [* -> paid]
+	CheckLimits(from, to go_fsm.State, fsmCtx go_fsm.FsmContext) error
+	// Pack is transition function [pack] of entry [shipped]
+	Pack(from, to go_fsm.State, fsmCtx go_fsm.FsmContext) error
+	// Notify is transition function [notify] of post_transition [* -> shipped]
+	Notify(from, to go_fsm.State, fsmCtx go_fsm.FsmContext) error
+}
+
+// NewOrderDefinition create the definition described by order.yaml with functions of the handlers
+func NewOrderDefinition(h OrderHandlers, opts ...go_fsm.Option) *go_fsm.Definition {
+	return go_fsm.NewDefinition(opts...).
+		When(OrderStateNew, nil).
+		StateTimeout(OrderStateNew, 30*time.Minute, OrderEventExpire).
+		When(OrderStatePaid, nil).
+		When(OrderStateShipped, h.Ship).
+		When(OrderStateCancelled, nil).
+		Final(OrderStateCancelled).
+		On(OrderStateNew, OrderEventPay, OrderStatePaid, go_fsm.GuardOption("hasFunds", h.HasFunds), go_fsm.TransitionActionOption(h.Charge), go_fsm.CompensationOption(h.Refund)).
+		On(OrderStateNew, OrderEventExpire, OrderStateCancelled).
+		On(OrderStatePaid, OrderEventNote, OrderStatePaid, go_fsm.TransitionActionOption(h.AddNote), go_fsm.InternalOption()).
+		On(OrderStatePaid, OrderEventShip, OrderStateShipped).
+		WhenAny(OrderEventCancel, h.Cancel).
+		RegisterPreCommitFunc("*", OrderStatePaid, h.CheckLimits).
+		OnEnter(OrderStateShipped, h.Pack).
+		RegisterPostTransitionFunc("*", OrderStateShipped, h.Notify)
+}
+
+// NewOrder create FSM described by order.yaml in the initial state
+func NewOrder(h OrderHandlers, opts ...go_fsm.Option) (*go_fsm.Fsm, error) {
+	return NewOrderDefinition(h, opts...).NewInstance(OrderInitialState)
+}
@@ -33,18 +33,12 @@ func main() {
 		When(
 			stateIdle,
 			func(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (next go_fsm.State, nextFsmCtx go_fsm.FsmContext, err error) {
-				var state go_fsm.State
 				var event go_fsm.Event
-				// get current state from eventCtx
+				// get current event from eventCtx
 				if event, err = go_fsm.EventFromCtx(eventCtx); err != nil {
 					return
 				}
 
-				// get current state from fsmContext
-				if state, err = go_fsm.StateFromCtx(fsmCtx); err != nil {
-					return
-				}
-
 				switch event {
 				case "moveRight":
 					log.Println("Action: move right")
@@ -58,9 +52,8 @@ func main() {
 					log.Println("Action: letsError")
 					next = "unknownState"
 				default:
-					// FSM must stay in current state
-					log.Println("Unknown event: ", event)
-					next = state
+					// the event is handled by the unhandled event action
+					err = go_fsm.ErrNotHandled
 				}
 
 				return
@@ -69,32 +62,34 @@ func main() {
 		When(
 			stateInAction,
 			func(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (next go_fsm.State, nextFsmCtx go_fsm.FsmContext, err error) {
-				var state go_fsm.State
 				var event go_fsm.Event
-				// get current state from eventCtx
+				// get current event from eventCtx
 				if event, err = go_fsm.EventFromCtx(eventCtx); err != nil {
 					return
 				}
 
-				// get current state from fsmContext
-				if state, err = go_fsm.StateFromCtx(fsmCtx); err != nil {
-					return
-				}
-
 				switch event {
 				case "stop":
 					log.Println("Action: stop")
 					log.Println("Degrees: ", fsmCtx.Value("degrees").(string))
 					next = stateIdle
 				default:
-					// FSM must stay in current state
-					log.Println("Unknown event: ", event)
-					next = state
+					// the event is handled by the unhandled event action
+					err = go_fsm.ErrNotHandled
 				}
 
 				return
 			},
 		).
+		WhenUnhandled(
+			func(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (next go_fsm.State, nextFsmCtx go_fsm.FsmContext, err error) {
+				event, _ := go_fsm.EventFromCtx(eventCtx)
+				// FSM must stay in current state
+				log.Println("Unknown event: ", event)
+				next, err = go_fsm.StateFromCtx(fsmCtx)
+				return
+			},
+		).
 		RegisterPostTransitionFunc("*", "*",
 			func(from, to go_fsm.State, fsmCtx go_fsm.FsmContext) error {
 				log.Println("Transition Function [ANY to ANY]")
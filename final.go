@@ -0,0 +1,81 @@
+package go_fsm
+
+type (
+	// TerminateReason describes why FSM has terminated
+	TerminateReason = string
+
+	// TerminateFunc is called when FSM terminates, it receives the last state and its context
+	TerminateFunc = func(reason TerminateReason, state State, fsmCtx FsmContext)
+)
+
+// ReasonFinalState means that FSM has entered a final state
+const ReasonFinalState TerminateReason = "final_state"
+
+//Final mark states as final, FSM which enters a final state stops accepting events (see ErrTerminated),
+//calls terminate functions and closes its Done channel
+func (def *Definition) Final(states ...State) *Definition {
+	def.update("Final", func(s *definitionSnapshot) {
+		for _, state := range states {
+			s.registerState(state, false)
+			s.finalStates[state] = true
+		}
+	})
+	return def
+}
+
+//OnTerminate add a function which is called when FSM terminates
+func (def *Definition) OnTerminate(fn TerminateFunc) *Definition {
+	def.update("OnTerminate", func(s *definitionSnapshot) {
+		s.terminateFuncs = append(s.terminateFuncs[:len(s.terminateFuncs):len(s.terminateFuncs)], fn)
+	})
+	return def
+}
+
+//Final mark FSM states as final
+func (fsm *Fsm) Final(states ...State) *Fsm {
+	fsm.def.Final(states...)
+	return fsm
+}
+
+//OnTerminate add a function which is called when FSM terminates
+func (fsm *Fsm) OnTerminate(fn TerminateFunc) *Fsm {
+	fsm.def.OnTerminate(fn)
+	return fsm
+}
+
+//Done return a channel which is closed when FSM terminates in a final state or is closed,
+//including the close caused by the parent context (see InitWithContext)
+func (fsm *Fsm) Done() <-chan struct{} {
+	return fsm.done.ch
+}
+
+// call terminate functions and stop FSM, the state and context are kept
+func (fsm *Fsm) terminate(def *definitionSnapshot, reason TerminateReason) {
+	for _, fn := range def.terminateFuncs {
+		fsm.callTerminateFunc(fn, reason)
+	}
+
+	fsm.release(StatusTerminated, reason)
+	fsm.logger.Info("FSM has terminated",
+		Field{Key: FieldState, Value: fsm.state},
+		Field{Key: FieldReason, Value: reason},
+	)
+}
+
+// call the terminate function, a panic is logged because FSM is stopped anyway
+func (fsm *Fsm) callTerminateFunc(fn TerminateFunc, reason TerminateReason) {
+	defer func() {
+		if p := recover(); p != nil {
+			fsm.logger.Error("Terminate function panicked",
+				Field{Key: FieldState, Value: fsm.state},
+				Field{Key: FieldError, Value: newPanicError(p, fsm.state, "")},
+			)
+		}
+	}()
+
+	fn(reason, fsm.state, fsm.ctx)
+}
+
+func (fsm *Fsm) closeDone() {
+	fsm.done.close()
+}
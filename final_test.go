@@ -0,0 +1,71 @@
+package go_fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsm_Final(t *testing.T) {
+	type termination struct {
+		reason TerminateReason
+		state  State
+		value  interface{}
+	}
+	var terminations []termination
+
+	fsm, err := NewFsm().
+		On("idle", "go", "running", TransitionActionOption(setValueAction("running"))).
+		On("running", "finish", "done").
+		Final("done").
+		OnTerminate(func(reason TerminateReason, state State, fsmCtx FsmContext) {
+			terminations = append(terminations, termination{reason, state, fsmCtx.Value(testCtxKey("value"))})
+		}).
+		OnTerminate(func(reason TerminateReason, state State, fsmCtx FsmContext) {
+			panic("terminate panic is logged")
+		}).
+		InitWithState("idle")
+	assert.NoError(t, err)
+	notifications, _ := fsm.Subscribe(nil)
+
+	assert.NoError(t, fsm.ProcessEvent("go", nil))
+	select {
+	case <-fsm.Done():
+		assert.Fail(t, "FSM is not terminated yet")
+	default:
+	}
+
+	// a batch can't continue after the final state
+	err = fsm.ProcessBatch([]Event{"finish", "go"}, nil)
+	assert.True(t, errors.Is(err, ErrTerminated))
+	assert.EqualError(t, err, "transition from [done] on event [go] failed: fsm is terminated")
+	assert.Equal(t, "running", fsm.CurrentState())
+	assert.Empty(t, terminations)
+
+	assert.NoError(t, fsm.ProcessEvent("finish", nil))
+	<-fsm.Done()
+	assert.Equal(t, []termination{{ReasonFinalState, "done", "running"}}, terminations)
+	assert.Equal(t, StatusTerminated, fsm.Status())
+	assert.Equal(t, ReasonFinalState, fsm.Reason())
+	assert.True(t, errors.Is(fsm.ProcessEvent("go", nil), ErrTerminated))
+
+	// subscription is closed after the last notification
+	var states []State
+	for n := range notifications {
+		states = append(states, n.To)
+	}
+	assert.Equal(t, []State{"running", "done"}, states)
+
+	// reset starts FSM again
+	assert.NoError(t, fsm.Reset())
+	assert.Equal(t, "idle", fsm.CurrentState())
+	select {
+	case <-fsm.Done():
+		assert.Fail(t, "FSM has been reset")
+	default:
+	}
+	fsm.Close()
+	<-fsm.Done()
+	assert.Equal(t, termination{ReasonClosed, "idle", nil}, terminations[1])
+}
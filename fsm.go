@@ -2,8 +2,10 @@ package go_fsm
 
 import (
 	"context"
-	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type (
@@ -17,52 +19,94 @@ type (
 	// results:
 	// next - the next state where to FSM try to arrive
 	// nextFsmCtx - context which will be used in next state
-	// err - possible error which can be raised by action handler
+	// err - possible error which can be raised by action handler,
+	// ErrNotHandled passes the event to the all-state action of the event and then to the unhandled event action
 	ActionFunc = func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error)
 )
 
+// Fsm is an instance of state machine, its behaviour is described by the shared Definition
 type Fsm struct {
-	logger Logger
+	def    *Definition
+	id     string
+	logger StructuredLogger
 
 	ctx          FsmContext
 	state        State
 	initialState State
+	// pending state timeout
+	timeoutEvent Event
+	deadline     time.Time
 
-	actionMap             map[State]ActionFunc
-	postTransitionFuncMap map[transitionKey][]TransitionFunc
-
+	// parent of FSM context which is used on reset
+	parent        context.Context
 	ctxCancelFunc context.CancelFunc
+	subscribers   *subscribers
+	// closed when FSM terminates or is closed
+	done   *doneChannel
+	status Status
+	// reason of termination or close
+	reason TerminateReason
 }
 
-// NewFsm create a new instance of FSM
+// NewFsm create a new instance of FSM with its own definition,
+// use NewDefinition and Definition.NewInstance to share one definition between many instances
 // if logger was not need should set it to nil
 func NewFsm(opts ...Option) *Fsm {
-	options := newOptions(opts...)
+	def := NewDefinition(opts...)
+	return def.newFsm(def.options.ID)
+}
 
-	fsm := &Fsm{
-		actionMap:             map[State]ActionFunc{},
-		logger:                options.Logger,
-		postTransitionFuncMap: map[transitionKey][]TransitionFunc{},
-	}
+// last generated FSM instance identifier
+var lastFsmID uint64
 
-	return fsm
+func newFsmID() string {
+	return "fsm-" + strconv.FormatUint(atomic.AddUint64(&lastFsmID, 1), 10)
 }
 
 //InitWithState init FSM with initial state
 func (fsm *Fsm) InitWithState(state State) (*Fsm, error) {
-	if !fsm.isStateExists(state) {
-		return nil, fmt.Errorf("invalid initial state [%s]", state)
+	return fsm.InitWithContext(context.Background(), state)
+}
+
+//InitWithContext init FSM with initial state, FSM context is derived from the parent context,
+//so FSM inherits its values and cancellation: when the parent is done FSM is closed with ReasonCanceled.
+//A running FSM is stopped before it's initialized again, terminate functions are not called.
+func (fsm *Fsm) InitWithContext(parent context.Context, state State) (*Fsm, error) {
+	if err := fsm.def.validateInitialState(state); err != nil {
+		return nil, err
 	}
 
-	fsm.ctx, fsm.ctxCancelFunc = context.WithCancel(context.Background())
-	fsm.state, fsm.initialState = state, state
-	fsm.logger.Log("Init FSM with state:", state)
+	fsm.def.publish()
+	fsm.stop()
+	fsm.initialState = state
+	fsm.parent = parent
+	fsm.start(parent, state)
+	fsm.logger.Info("FSM initialized", Field{Key: FieldState, Value: state})
 	return fsm, nil
 }
 
-func (fsm Fsm) isStateExists(state State) bool {
-	_, isset := fsm.actionMap[state]
-	return isset
+// start FSM in the state, main context is derived from the parent
+func (fsm *Fsm) start(parent context.Context, state State) {
+	fsm.ctx, fsm.ctxCancelFunc = context.WithCancel(parent)
+	fsm.state = state
+	fsm.armTimeout(fsm.def.load())
+	fsm.def.metrics.StateEntered(state)
+	fsm.status, fsm.reason = StatusRunning, ""
+	fsm.subscribers.reopen()
+	if fsm.done.isClosed() {
+		fsm.done = newDoneChannel()
+	}
+	fsm.watchParent(parent)
+}
+
+//ID return FSM instance identifier
+func (fsm Fsm) ID() string {
+	return fsm.id
+}
+
+//Definition return FSM definition
+func (fsm Fsm) Definition() *Definition {
+	return fsm.def
 }
 
 //CurrentState return FSM current state
@@ -71,123 +115,375 @@ func (fsm Fsm) CurrentState() State {
 }
 
 //When FSM event configuration
-func (fsm *Fsm) When(state State, action ActionFunc) *Fsm {
-	fsm.actionMap[state] = action
-	fsm.logger.Logf("Added an action function for state [%s]", state)
+func (fsm *Fsm) When(state State, action ActionFunc, opts ...ActionOption) *Fsm {
+	fsm.def.When(state, action, opts...)
 	return fsm
 }
 
+//ReplaceAction replace action function of the state in FSM definition (see Definition.ReplaceAction)
+func (fsm *Fsm) ReplaceAction(state State, action ActionFunc) error {
+	return fsm.def.ReplaceAction(state, action)
+}
+
 //Process event by current state action function
 func (fsm *Fsm) ProcessEvent(event Event, eventCtx EventContext) error {
-	fsm.logger.Logf("Trying to handle [%s] event", event)
+	tx := fsm.begin()
+	if err := fsm.processStep(tx, event, eventCtx); err != nil {
+		return fsm.rollback(tx, func() error { return err })
+	}
+	return fsm.commit(tx, eventCtx)
+}
+
+// process event as a step of the transaction
+func (fsm *Fsm) processStep(tx *transaction, event Event, eventCtx EventContext) error {
+	fsm.logger.Debug("Handling event", Field{Key: FieldState, Value: fsm.state}, Field{Key: FieldEvent, Value: event})
+	fsm.def.metrics.EventProcessed(fsm.state, event)
 	// check context for nil
-	eventCtx = ctxWithEvent(checkAndFixEmptyContext(eventCtx), event)
+	eventCtx = ctxWithTransaction(ctxWithEvent(checkAndFixEmptyContext(eventCtx), event), tx)
+
+	// open event span, it's a parent for action and transition functions spans
+	eventCtx, span := fsm.def.tracer.Start(eventCtx, SpanProcessEvent,
+		Attribute{Key: AttrState, Value: fsm.state},
+		Attribute{Key: AttrEvent, Value: event},
+	)
+	err := fsm.processEvent(tx, event, eventCtx, span)
+	endSpan(span, err)
 
-	// get action function for this state
-	f, ok := fsm.actionMap[fsm.state]
-	if !ok || f == nil {
-		fsm.logger.Logf("For event [%s] state [%s] action function is not defined", event, fsm.state)
-		return ErrActionNotFound
+	return err
+}
+
+func (fsm *Fsm) processEvent(tx *transaction, event Event, eventCtx EventContext, span Span) error {
+	// the same definition snapshot is used during the whole event processing
+	def := fsm.def.load()
+
+	if err := fsm.checkAccepting(def); err != nil {
+		return fsm.fail(event, "", err)
+	}
+
+	// get action functions which can handle the event in this state
+	actions := def.actions(fsm.state, event)
+	if len(actions) == 0 {
+		fsm.logger.Error("Action function is not defined",
+			Field{Key: FieldState, Value: fsm.state},
+			Field{Key: FieldEvent, Value: event},
+		)
+		return fsm.fail(event, "", ErrActionNotFound)
 	}
 
 	// check fsm and event contexts for error before the action call
 	if err := checkErrors(fsm.ctx.Err(), eventCtx.Err()); err != nil {
-		return err
+		return fsm.fail(event, "", err)
 	}
 
 	// create new context with current state value
 	fsmCtx := ctxWithState(fsm.ctx, fsm.state)
-	nextState, nextCtx, err := f(eventCtx, fsmCtx)
+	actionCtx, actionSpan := fsm.def.tracer.Start(eventCtx, SpanAction,
+		Attribute{Key: AttrState, Value: fsm.state},
+		Attribute{Key: AttrEvent, Value: event},
+	)
+	startedAt := time.Now()
+	nextState, nextCtx, err := callActions(actions, actionCtx, fsmCtx, fsm.state, event)
+	fsm.def.metrics.ObserveAction(fsm.state, event, time.Since(startedAt))
+	if err == nil {
+		actionSpan.SetAttributes(Attribute{Key: AttrNextState, Value: nextState})
+	}
+	endSpan(actionSpan, err)
 	if err != nil {
-		return err
+		if _, ok := err.(*PanicError); ok {
+			fsm.logger.Error("Action function panicked",
+				Field{Key: FieldState, Value: fsm.state},
+				Field{Key: FieldEvent, Value: event},
+				Field{Key: FieldError, Value: err},
+			)
+		}
+		return fsm.fail(event, "", err)
+	}
+	span.SetAttributes(Attribute{Key: AttrNextState, Value: nextState})
+
+	// self-transition marked by InternalTransition changes the context only
+	internal := false
+	if ic, ok := nextCtx.(internalContext); ok {
+		nextCtx, internal = ic.Context, nextState == fsm.state
 	}
 
 	// set previous fsm context to next fsm context if nil has been returned by action handler (under the hood magic)
 	if nil == nextCtx {
 		nextCtx = fsmCtx
+		if internal {
+			nextCtx = fsm.ctx
+		}
 	}
 
 	// check fsm, nextFsm and event contexts for error after the action call
 	if err := checkErrors(eventCtx.Err(), fsmCtx.Err(), nextCtx.Err()); err != nil {
-		return err
+		return fsm.fail(event, nextState, err)
 	}
 
 	// is next state found?
-	if !fsm.isStateExists(nextState) {
-		fsm.logger.Logf("State [%s] not found", nextState)
-		return ErrActionNotFound
+	if !def.isStateExists(nextState) {
+		fsm.logger.Error("Next state not found",
+			Field{Key: FieldState, Value: fsm.state},
+			Field{Key: FieldEvent, Value: event},
+			Field{Key: FieldNextState, Value: nextState},
+		)
+		return fsm.fail(event, nextState, ErrUnknownNextState)
+	}
+
+	// internal self-transition doesn't run pre-commit and post transition functions and doesn't re-arm the state timeout
+	if internal {
+		tx.steps = append(tx.steps, TransitionNotification{
+			FsmID:    fsm.id,
+			From:     fsm.state,
+			To:       nextState,
+			Event:    event,
+			Time:     time.Now(),
+			Internal: true,
+		})
+		fsm.ctx = nextCtx
+		return nil
+	}
+
+	// transition functions receive the context with the transaction, so they can register compensations
+	hookCtx := ctxWithTransaction(nextCtx, tx)
+
+	// exit functions of the current state and entry functions of the next state can reject the transition
+	for _, hooks := range []struct {
+		name string
+		fns  []TransitionFunc
+	}{{"Exit", def.exitFuncMap[fsm.state]}, {"Entry", def.entryFuncMap[nextState]}} {
+		for _, fn := range hooks.fns {
+			if err := fsm.runTransitionFunc(eventCtx, fn, fsm.state, nextState, hookCtx, event); err != nil {
+				fsm.logger.Warn(hooks.name+" function rejected transition",
+					Field{Key: FieldState, Value: fsm.state},
+					Field{Key: FieldEvent, Value: event},
+					Field{Key: FieldNextState, Value: nextState},
+					Field{Key: FieldError, Value: err},
+				)
+				return fsm.fail(event, nextState, err)
+			}
+		}
+	}
+
+	// pre-commit functions can reject the transition
+	for _, key := range transitionKeys(fsm.state, nextState) {
+		for _, hook := range def.preCommitFuncMap[key] {
+			if err := fsm.runTransitionFunc(eventCtx, hook.fn, fsm.state, nextState, hookCtx, event); err != nil {
+				fsm.logger.Warn("Pre-commit function rejected transition",
+					Field{Key: FieldState, Value: fsm.state},
+					Field{Key: FieldEvent, Value: event},
+					Field{Key: FieldNextState, Value: nextState},
+					Field{Key: FieldError, Value: err},
+				)
+				return fsm.fail(event, nextState, err)
+			}
+		}
 	}
 
 	{
 		// create waiting group to sync finish for all async transition functions
 		wg := new(sync.WaitGroup)
+		hookPanic := new(transitionPanic)
 		// process post state action transition functions [strict to strict]
-		if transitionFunctions, ok := fsm.postTransitionFuncMap[newTransitionKey(fsm.state, nextState)]; ok && len(transitionFunctions) > 0 {
-			fsm.processTransitionFunctions(wg, nextState, nextCtx, transitionFunctions)
+		if transitionFunctions, ok := def.postTransitionFuncMap[newTransitionKey(fsm.state, nextState)]; ok && len(transitionFunctions) > 0 {
+			fsm.processTransitionFunctions(wg, hookPanic, eventCtx, event, nextState, hookCtx, transitionFunctions)
 		}
 
 		// process post state action transition functions [strict to any]
-		if transitionFunctions, ok := fsm.postTransitionFuncMap[newTransitionKey(fsm.state, "*")]; ok && len(transitionFunctions) > 0 {
-			fsm.processTransitionFunctions(wg, nextState, nextCtx, transitionFunctions)
+		if transitionFunctions, ok := def.postTransitionFuncMap[newTransitionKey(fsm.state, "*")]; ok && len(transitionFunctions) > 0 {
+			fsm.processTransitionFunctions(wg, hookPanic, eventCtx, event, nextState, hookCtx, transitionFunctions)
 		}
 
 		// process post state action transition functions [any to strict]
-		if transitionFunctions, ok := fsm.postTransitionFuncMap[newTransitionKey("*", nextState)]; ok && len(transitionFunctions) > 0 {
-			fsm.processTransitionFunctions(wg, nextState, nextCtx, transitionFunctions)
+		if transitionFunctions, ok := def.postTransitionFuncMap[newTransitionKey("*", nextState)]; ok && len(transitionFunctions) > 0 {
+			fsm.processTransitionFunctions(wg, hookPanic, eventCtx, event, nextState, hookCtx, transitionFunctions)
 		}
 
 		// process post state action transition functions [any to any]
-		if transitionFunctions, ok := fsm.postTransitionFuncMap[newTransitionKey("*", "*")]; ok && len(transitionFunctions) > 0 {
-			fsm.processTransitionFunctions(wg, nextState, nextCtx, transitionFunctions)
+		if transitionFunctions, ok := def.postTransitionFuncMap[newTransitionKey("*", "*")]; ok && len(transitionFunctions) > 0 {
+			fsm.processTransitionFunctions(wg, hookPanic, eventCtx, event, nextState, hookCtx, transitionFunctions)
 		}
 
 		// waiting until all transition functions are finished
 		wg.Wait()
+
+		// FSM stays in the current state if any transition function has panicked
+		if hookPanic.err != nil {
+			fsm.logger.Error("Post transition function panicked",
+				Field{Key: FieldState, Value: fsm.state},
+				Field{Key: FieldEvent, Value: event},
+				Field{Key: FieldNextState, Value: nextState},
+				Field{Key: FieldError, Value: hookPanic.err},
+			)
+			return fsm.fail(event, nextState, hookPanic.err)
+		}
 	}
 
-	// update current state and context
+	// update current state and context, metrics and subscribers are updated on the transaction commit
+	tx.steps = append(tx.steps, TransitionNotification{
+		FsmID: fsm.id,
+		From:  fsm.state,
+		To:    nextState,
+		Event: event,
+		Time:  time.Now(),
+	})
 	fsm.state = nextState
 	fsm.ctx = nextCtx
+	fsm.armTimeout(def)
 
 	return nil
 }
 
-// close main context and stop all events processing (a try to process event always return an error)
-func (fsm *Fsm) Close() {
-	fsm.ctxCancelFunc()
-	fsm.logger.Log("FSM has closed")
+// return an error if FSM doesn't accept events
+func (fsm *Fsm) checkAccepting(def *definitionSnapshot) error {
+	switch fsm.Status() {
+	case StatusCreated:
+		return ErrNotInitialized
+	case StatusClosed:
+		return ErrClosed
+	case StatusTerminated:
+		return ErrTerminated
+	}
+	// FSM in a final state doesn't accept events (the state is entered by a previous event of the batch)
+	if def.finalStates[fsm.state] {
+		return ErrTerminated
+	}
+	return nil
 }
 
-// reset FSM state to initial state and initial context
-func (fsm *Fsm) Reset() error {
-	fsm.Close()
-	if _, err := fsm.InitWithState(fsm.initialState); err != nil {
+// report event processing error to metrics and return it wrapped by TransitionError,
+// PanicError is returned as is because it already carries the state and the event
+func (fsm *Fsm) fail(event Event, next State, err error) error {
+	fsm.def.metrics.ErrorOccurred(errorKindOf(err), fsm.state, event)
+	return fsm.transitionError(event, next, err)
+}
+
+// wrap event processing error by TransitionError, PanicError is returned as is
+func (fsm *Fsm) transitionError(event Event, next State, err error) error {
+	if _, ok := err.(*PanicError); ok {
 		return err
 	}
+	return &TransitionError{From: fsm.state, Event: event, Next: next, Cause: err}
+}
 
-	fsm.logger.Log("FSM has reset")
-	return nil
+// close main context and stop all events processing (a try to process event always return an error),
+// all subscription channels are closed as well. Terminate functions are called with ReasonClosed.
+func (fsm *Fsm) Close() {
+	fsm.CloseWithReason(ReasonClosed)
+}
+
+// cancel main context, subscriptions are kept
+func (fsm *Fsm) stop() {
+	if fsm.status == StatusRunning {
+		fsm.def.metrics.StateExited(fsm.state)
+		fsm.ctxCancelFunc()
+	}
 }
 
-//RegisterPostTransitionFunc add a transition function
+// reset FSM state to initial state and initial context, subscriptions are kept
+func (fsm *Fsm) Reset() error {
+	return fsm.ResetWith()
+}
+
+//On FSM declarative transition configuration
+func (fsm *Fsm) On(from State, event Event, to State, opts ...TransitionOption) *Fsm {
+	fsm.def.On(from, event, to, opts...)
+	return fsm
+}
+
+//WhenAny FSM all-state event configuration
+func (fsm *Fsm) WhenAny(event Event, action ActionFunc, opts ...ActionOption) *Fsm {
+	fsm.def.WhenAny(event, action, opts...)
+	return fsm
+}
+
+//WhenUnhandled FSM unhandled event configuration
+func (fsm *Fsm) WhenUnhandled(action ActionFunc, opts ...ActionOption) *Fsm {
+	fsm.def.WhenUnhandled(action, opts...)
+	return fsm
+}
+
+//RegisterPreCommitFunc add a function which is called before the transition is committed
+func (fsm *Fsm) RegisterPreCommitFunc(fromState, toState State, fn TransitionFunc) *Fsm {
+	fsm.def.RegisterPreCommitFunc(fromState, toState, fn)
+	return fsm
+}
+
+//RegisterPostTransitionFunc add a transition function.
+//
+//Deprecated: use Definition.AddPostTransitionFunc, RegisterPostTransitionFunc is kept because it returns FSM for chaining.
 func (fsm *Fsm) RegisterPostTransitionFunc(fromState, toState State, fn TransitionFunc) *Fsm {
-	key := newTransitionKey(fromState, toState)
-	fsm.postTransitionFuncMap[key] = append(fsm.postTransitionFuncMap[key], fn)
+	fsm.def.RegisterPostTransitionFunc(fromState, toState, fn)
 	return fsm
 }
 
-func (fsm *Fsm) processTransitionFunctions(wg *sync.WaitGroup, nextState State, nextCtx FsmContext, transitionFunctions []TransitionFunc) {
+//OnEnter add a function which is called when the state is entered by an external transition
+func (fsm *Fsm) OnEnter(state State, fn TransitionFunc) *Fsm {
+	fsm.def.OnEnter(state, fn)
+	return fsm
+}
+
+//OnExit add a function which is called when the state is exited by an external transition
+func (fsm *Fsm) OnExit(state State, fn TransitionFunc) *Fsm {
+	fsm.def.OnExit(state, fn)
+	return fsm
+}
+
+func (fsm *Fsm) processTransitionFunctions(wg *sync.WaitGroup, hookPanic *transitionPanic, eventCtx EventContext, event Event, nextState State, nextCtx FsmContext, transitionFunctions []*HookRegistration) {
 	wg.Add(len(transitionFunctions))
-	for _, fn := range transitionFunctions {
+	for _, hook := range transitionFunctions {
 		go func(from, to State, ctx FsmContext, f TransitionFunc) {
-			if err := f(from, to, ctx); err != nil {
-				fsm.logger.Logf("Post transition function state [%s]->[%s] call error [%s]",
-					from,
-					to,
-					err.Error(),
+			defer wg.Done()
+
+			err := fsm.runTransitionFunc(eventCtx, f, from, to, ctx, event)
+			if panicErr, ok := err.(*PanicError); ok {
+				hookPanic.set(panicErr)
+				return
+			}
+			if err != nil {
+				fsm.logger.Warn("Post transition function failed",
+					Field{Key: FieldState, Value: from},
+					Field{Key: FieldNextState, Value: to},
+					Field{Key: FieldError, Value: err},
 				)
 			}
-			wg.Done()
-		}(fsm.state, nextState, nextCtx, fn)
+		}(fsm.state, nextState, nextCtx, hook.fn)
 	}
 }
+
+// runTransitionFunc calls the transition function in a child span of the event span and observes its duration.
+// The span is propagated to the function via fsm context.
+func (fsm *Fsm) runTransitionFunc(eventCtx EventContext, fn TransitionFunc, from, to State, fsmCtx FsmContext, event Event) error {
+	_, span := fsm.def.tracer.Start(eventCtx, SpanTransitionFunc,
+		Attribute{Key: AttrState, Value: from},
+		Attribute{Key: AttrNextState, Value: to},
+	)
+	startedAt := time.Now()
+	err := callTransitionFunc(fn, from, to, fsm.def.tracer.ContextWithSpan(fsmCtx, span), event)
+	fsm.def.metrics.ObserveTransitionFunc(from, to, time.Since(startedAt))
+	endSpan(span, err)
+	return err
+}
+
+// the first panic raised by transition functions
+type transitionPanic struct {
+	once sync.Once
+	err  *PanicError
+}
+
+func (p *transitionPanic) set(err *PanicError) {
+	p.once.Do(func() {
+		p.err = err
+	})
+}
+
+// Subscribe to committed transitions. Delivery is non-blocking: if the subscriber buffer is full
+// the notification is dropped and counted (see TransitionNotification.Dropped and DroppedNotifications).
+// The channel is closed by the cancel function or when FSM is closed.
+func (fsm *Fsm) Subscribe(filter SubscriptionFilter) (<-chan TransitionNotification, func()) {
+	return fsm.subscribers.subscribe(filter)
+}
+
+// DroppedNotifications return the total number of notifications dropped for all subscribers
+func (fsm *Fsm) DroppedNotifications() uint64 {
+	return fsm.subscribers.droppedCount()
+}
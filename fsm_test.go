@@ -2,6 +2,7 @@ package go_fsm
 
 import (
 	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"log"
 	"sync/atomic"
@@ -36,7 +37,21 @@ func TestNewFsm(t *testing.T) {
 		logger := &customLogger{}
 		fsm := NewFsm(LoggerOption(logger))
 		assert.NotNil(t, fsm)
-		assert.Equal(t, logger, fsm.logger)
+		assert.IsType(t, &fieldsLogger{}, fsm.logger)
+	})
+
+	t.Run("With the structured logger", func(t *testing.T) {
+		logger := &recordingLogger{}
+		fsm, err := NewFsm(StructuredLoggerOption(logger), IDOption("order-1")).
+			When("idle", emptyStateActionFunc("idle")).
+			InitWithState("idle")
+		assert.NoError(t, err)
+		assert.Equal(t, "order-1", fsm.ID())
+		assert.Contains(t, logger.lines(), "level=INFO msg=\"FSM initialized\" fsm_id=order-1 state=idle")
+	})
+
+	t.Run("Generated ID", func(t *testing.T) {
+		assert.NotEqual(t, NewFsm().ID(), NewFsm().ID())
 	})
 }
 
@@ -60,7 +75,8 @@ func TestFsm_When(t *testing.T) {
 		fsm, err := NewFsm().When("idle", nil).InitWithState("idle")
 		assert.NoError(t, err)
 		if e := fsm.ProcessEvent("someEvent", nil); e != nil {
-			assert.EqualError(t, e, ErrActionNotFound.Error())
+			assert.True(t, errors.Is(e, ErrActionNotFound))
+			assert.EqualError(t, e, "transition from [idle] on event [someEvent] failed: action not found")
 			assert.Equal(t, "idle", fsm.state)
 		}
 	})
@@ -72,7 +88,7 @@ func TestFsm_When(t *testing.T) {
 				InitWithState("idle")
 		assert.NoError(t, err)
 		if e := fsm.ProcessEvent("someEvent", nil); e != nil {
-			assert.EqualError(t, e, ErrActionNotFound.Error())
+			assert.True(t, errors.Is(e, ErrUnknownNextState))
 			assert.Equal(t, "idle", fsm.state)
 		}
 	})
@@ -91,7 +107,13 @@ func TestFsm_When(t *testing.T) {
 				InitWithState("idle")
 		assert.NoError(t, err)
 		if e := fsm.ProcessEvent("someEvent", nil); e != nil {
-			assert.EqualError(t, e, ErrActionNotFound.Error())
+			var transitionErr *TransitionError
+			if assert.True(t, errors.As(e, &transitionErr)) {
+				assert.Equal(t, "idle", transitionErr.From)
+				assert.Equal(t, "someEvent", transitionErr.Event)
+				assert.Equal(t, "someEvent", transitionErr.Next)
+				assert.Equal(t, ErrUnknownNextState, transitionErr.Cause)
+			}
 			assert.Equal(t, "idle", fsm.state)
 		}
 	})
@@ -132,7 +154,8 @@ func TestFsm_Close(t *testing.T) {
 
 	fsm.Close()
 	err = fsm.ProcessEvent("someEvent", nil)
-	assert.EqualError(t, err, "context canceled")
+	assert.True(t, errors.Is(err, ErrClosed))
+	assert.EqualError(t, err, "transition from [idle] on event [someEvent] failed: fsm is closed")
 }
 
 func TestFsm_Reset(t *testing.T) {
@@ -237,20 +260,17 @@ func TestFsm_AddTransitionFunc(t *testing.T) {
 }
 
 func TestFsm_isStateExists(t *testing.T) {
-	fsm := &Fsm{
-		actionMap: map[State]ActionFunc{
-			"state1": func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
-				return "state2", nil, nil
-			},
-			"state2": func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
-				return "state1", nil, nil
-			},
-		},
-	}
-
-	assert.True(t, fsm.isStateExists("state1"))
-	assert.True(t, fsm.isStateExists("state2"))
-	assert.False(t, fsm.isStateExists("state3"))
+	fsm := NewFsm().
+		When("state1", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			return "state2", nil, nil
+		}).
+		When("state2", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			return "state1", nil, nil
+		})
+
+	assert.True(t, fsm.def.load().isStateExists("state1"))
+	assert.True(t, fsm.def.load().isStateExists("state2"))
+	assert.False(t, fsm.def.load().isStateExists("state3"))
 }
 
 func TestFsm_CurrentState(t *testing.T) {
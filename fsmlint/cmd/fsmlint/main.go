@@ -0,0 +1,14 @@
+// Command fsmlint checks states used by go-fsm definitions, it's run by go vet:
+//
+//	go install github.com/igorrius/go-fsm/fsmlint/cmd/fsmlint@latest
+//	go vet -vettool=$(which fsmlint) ./...
+package main
+
+import (
+	"github.com/igorrius/go-fsm/fsmlint"
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+func main() {
+	unitchecker.Main(fsmlint.Analyzer)
+}
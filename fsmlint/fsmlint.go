@@ -0,0 +1,240 @@
+// Package fsmlint defines an analyzer which checks states used by go-fsm definitions of a package:
+// constant states returned by action functions registered with When, WhenAny or WhenUnhandled and
+// states of transition functions must be registered by When, Final or as the source state of On.
+// The analyzer is conservative: a package which registers a non-constant state is not checked.
+package fsmlint
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"strconv"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const fsmPath = "github.com/igorrius/go-fsm"
+
+// Analyzer reports unregistered states returned by action functions and used by transition functions
+var Analyzer = &analysis.Analyzer{
+	Name:     "fsmlint",
+	Doc:      "check that states returned by go-fsm action functions and states of transition functions are registered",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// registration methods of Fsm and Definition and indexes of their state arguments (-1 means all arguments),
+// the target of On isn't registered by On, a transition to it is rejected unless it's registered elsewhere
+var stateArgs = map[string][]int{
+	"When":  {0},
+	"On":    {0},
+	"Final": {-1},
+}
+
+// methods which register action functions and indexes of the function argument
+var actionArgs = map[string]int{
+	"When":          1,
+	"WhenAny":       1,
+	"WhenUnhandled": 0,
+}
+
+// methods which register transition functions
+var hookMethods = map[string]string{
+	"RegisterPostTransitionFunc": "post transition",
+	"RegisterPreCommitFunc":      "pre commit",
+	"AddPostTransitionFunc":      "post transition",
+	"AddPreCommitFunc":           "pre commit",
+}
+
+type checker struct {
+	pass *analysis.Pass
+	// function declarations of the package
+	funcs  map[*types.Func]*ast.FuncDecl
+	states map[string]bool
+	// a state is registered by a non-constant expression, so registered states are unknown
+	dynamic bool
+	actions []ast.Expr
+	hooks   []*ast.CallExpr
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	c := &checker{pass: pass, funcs: map[*types.Func]*ast.FuncDecl{}, states: map[string]bool{}}
+
+	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil), (*ast.CallExpr)(nil)}, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if fn, ok := pass.TypesInfo.Defs[n.Name].(*types.Func); ok {
+				c.funcs[fn] = n
+			}
+		case *ast.CallExpr:
+			c.collect(n)
+		}
+	})
+	if c.dynamic || len(c.states) == 0 {
+		return nil, nil
+	}
+
+	for _, call := range c.hooks {
+		c.checkHook(call)
+	}
+	checked := map[ast.Node]bool{}
+	for _, action := range c.actions {
+		for _, fn := range c.actionFuncs(action, map[*types.Func]bool{}) {
+			if !checked[fn] {
+				checked[fn] = true
+				c.checkAction(fn)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// name of go-fsm method which is called by the call expression
+func (c *checker) method(call *ast.CallExpr) string {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	fn, ok := c.pass.TypesInfo.Uses[sel.Sel].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != fsmPath {
+		return ""
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return ""
+	}
+	return fn.Name()
+}
+
+// collect registered states, action functions and transition functions
+func (c *checker) collect(call *ast.CallExpr) {
+	name := c.method(call)
+	if name == "" {
+		return
+	}
+
+	for _, i := range stateArgs[name] {
+		args := call.Args
+		if i >= len(args) {
+			continue
+		}
+		if i >= 0 {
+			args = args[i : i+1]
+		}
+		for _, arg := range args {
+			if state, ok := c.constString(arg); ok {
+				c.states[state] = true
+			} else {
+				c.dynamic = true
+			}
+		}
+	}
+	if i, ok := actionArgs[name]; ok && i < len(call.Args) {
+		c.actions = append(c.actions, call.Args[i])
+	}
+	if _, ok := hookMethods[name]; ok {
+		c.hooks = append(c.hooks, call)
+	}
+}
+
+func (c *checker) constString(expr ast.Expr) (string, bool) {
+	tv, ok := c.pass.TypesInfo.Types[expr]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+func (c *checker) checkHook(call *ast.CallExpr) {
+	kind := hookMethods[c.method(call)]
+	for _, arg := range call.Args[:2] {
+		state, ok := c.constString(arg)
+		if ok && state != "*" && !c.states[state] {
+			c.pass.Reportf(arg.Pos(), "%s function is registered for unknown state %s", kind, strconv.Quote(state))
+		}
+	}
+}
+
+// function literals and declarations which implement the action function expression:
+// a literal, a function of the package or a call of a function of the package which returns literals
+func (c *checker) actionFuncs(expr ast.Expr, visited map[*types.Func]bool) []ast.Node {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.FuncLit:
+		return []ast.Node{e}
+	case *ast.Ident:
+		if decl := c.funcDecl(e, visited); decl != nil {
+			return []ast.Node{decl}
+		}
+	case *ast.CallExpr:
+		id, ok := ast.Unparen(e.Fun).(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		decl := c.funcDecl(id, visited)
+		if decl == nil || decl.Body == nil {
+			return nil
+		}
+		var funcs []ast.Node
+		ast.Inspect(decl.Body, func(n ast.Node) bool {
+			if _, ok := n.(*ast.FuncLit); ok {
+				return false
+			}
+			if ret, ok := n.(*ast.ReturnStmt); ok && len(ret.Results) == 1 {
+				funcs = append(funcs, c.actionFuncs(ret.Results[0], visited)...)
+			}
+			return true
+		})
+		return funcs
+	}
+	return nil
+}
+
+func (c *checker) funcDecl(id *ast.Ident, visited map[*types.Func]bool) *ast.FuncDecl {
+	fn, ok := c.pass.TypesInfo.Uses[id].(*types.Func)
+	if !ok || visited[fn] {
+		return nil
+	}
+	visited[fn] = true
+	return c.funcs[fn]
+}
+
+// report constant next states of the action function which are not registered
+func (c *checker) checkAction(fn ast.Node) {
+	var body *ast.BlockStmt
+	switch fn := fn.(type) {
+	case *ast.FuncLit:
+		body = fn.Body
+	case *ast.FuncDecl:
+		body = fn.Body
+	}
+	if body == nil {
+		return
+	}
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		ret, ok := n.(*ast.ReturnStmt)
+		if !ok || len(ret.Results) != 3 {
+			return true
+		}
+		state, ok := c.constString(ret.Results[0])
+		switch {
+		case !ok:
+		case state == "" && c.isNil(ret.Results[2]):
+			c.pass.Reportf(ret.Results[0].Pos(), "action function returns an empty next state without an error")
+		case state != "" && !c.states[state]:
+			c.pass.Reportf(ret.Results[0].Pos(), "action function returns state %s which is not registered", strconv.Quote(state))
+		}
+		return true
+	})
+}
+
+func (c *checker) isNil(expr ast.Expr) bool {
+	tv, ok := c.pass.TypesInfo.Types[expr]
+	return ok && tv.IsNil()
+}
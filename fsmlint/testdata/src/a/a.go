@@ -0,0 +1,64 @@
+package a
+
+import (
+	"errors"
+
+	go_fsm "github.com/igorrius/go-fsm"
+)
+
+const (
+	stateIdle    = "idle"
+	stateRunning = "running"
+)
+
+func next(state go_fsm.State) go_fsm.ActionFunc {
+	return func(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.State, go_fsm.FsmContext, error) {
+		return state, fsmCtx, nil
+	}
+}
+
+func toStopped() go_fsm.ActionFunc {
+	return func(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.State, go_fsm.FsmContext, error) {
+		return "stopped", fsmCtx, nil // want `action function returns state "stopped" which is not registered`
+	}
+}
+
+func idle(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.State, go_fsm.FsmContext, error) {
+	if eventCtx == nil {
+		return "", nil, errors.New("no event context")
+	}
+	if fsmCtx == nil {
+		return "", fsmCtx, nil // want `action function returns an empty next state without an error`
+	}
+	return stateRunning, fsmCtx, nil
+}
+
+func hook(from, to go_fsm.State, fsmCtx go_fsm.FsmContext) error {
+	return nil
+}
+
+func definition() *go_fsm.Definition {
+	return go_fsm.NewDefinition().
+		When(stateIdle, idle).
+		When(stateRunning, func(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.State, go_fsm.FsmContext, error) {
+			switch {
+			case eventCtx == nil:
+				return "paused", fsmCtx, nil // want `action function returns state "paused" which is not registered`
+			case fsmCtx == nil:
+				return "done", fsmCtx, nil // want `action function returns state "done" which is not registered`
+			}
+			return stateIdle, fsmCtx, nil
+		}).
+		On(stateRunning, "finish", "done").
+		Final("failed").
+		WhenAny("stop", toStopped()).
+		WhenUnhandled(next(stateIdle)).
+		RegisterPostTransitionFunc("*", "failed", hook).
+		RegisterPostTransitionFunc(stateIdle, "finished", hook). // want `post transition function is registered for unknown state "finished"`
+		RegisterPreCommitFunc("starting", "*", hook)             // want `pre commit function is registered for unknown state "starting"`
+}
+
+func feature(def *go_fsm.Definition) *go_fsm.HookRegistration {
+	def.AddPreCommitFunc("audited", stateIdle, hook)       // want `pre commit function is registered for unknown state "audited"`
+	return def.AddPostTransitionFunc("*", "unknown", hook) // want `post transition function is registered for unknown state "unknown"`
+}
@@ -0,0 +1,12 @@
+package b
+
+import go_fsm "github.com/igorrius/go-fsm"
+
+// states are not known if one of them is registered dynamically
+func definition(state go_fsm.State) *go_fsm.Definition {
+	return go_fsm.NewDefinition().
+		When(state, func(eventCtx go_fsm.EventContext, fsmCtx go_fsm.FsmContext) (go_fsm.State, go_fsm.FsmContext, error) {
+			return "unknown", fsmCtx, nil
+		}).
+		RegisterPostTransitionFunc("*", "unknown", nil)
+}
@@ -0,0 +1,39 @@
+// Package go_fsm is a stub of go-fsm API used by the analyzer
+package go_fsm
+
+import "context"
+
+type (
+	State          = string
+	Event          = string
+	EventContext   = context.Context
+	FsmContext     = context.Context
+	ActionFunc     = func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error)
+	TransitionFunc = func(from, to State, fsmCtx FsmContext) error
+)
+
+type Definition struct{}
+
+type HookRegistration struct{}
+
+func (h *HookRegistration) Unregister() {}
+
+func NewDefinition() *Definition { return &Definition{} }
+
+func (def *Definition) When(state State, action ActionFunc) *Definition    { return def }
+func (def *Definition) On(from State, event Event, to State) *Definition   { return def }
+func (def *Definition) Final(states ...State) *Definition                  { return def }
+func (def *Definition) WhenAny(event Event, action ActionFunc) *Definition { return def }
+func (def *Definition) WhenUnhandled(action ActionFunc) *Definition        { return def }
+func (def *Definition) RegisterPreCommitFunc(from, to State, fn TransitionFunc) *Definition {
+	return def
+}
+func (def *Definition) RegisterPostTransitionFunc(from, to State, fn TransitionFunc) *Definition {
+	return def
+}
+func (def *Definition) AddPostTransitionFunc(from, to State, fn TransitionFunc) *HookRegistration {
+	return &HookRegistration{}
+}
+func (def *Definition) AddPreCommitFunc(from, to State, fn TransitionFunc) *HookRegistration {
+	return &HookRegistration{}
+}
@@ -2,4 +2,7 @@ module github.com/igorrius/go-fsm
 
 go 1.13
 
-require github.com/stretchr/testify v1.4.0
+require (
+	github.com/stretchr/testify v1.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,88 @@
+package go_fsm
+
+// HookRegistration is a handle of a transition function registered by AddPreCommitFunc or AddPostTransitionFunc
+type HookRegistration struct {
+	def *Definition
+	key HookKey
+	fn  TransitionFunc
+}
+
+// Key return kind and states the transition function is registered for
+func (h *HookRegistration) Key() HookKey {
+	return h.key
+}
+
+// Unregister remove the transition function from the definition, it's safe to call it more than once and
+// concurrently with event processing: an event which is being processed still calls the function,
+// the following events don't
+func (h *HookRegistration) Unregister() {
+	key := newTransitionKey(h.key.From, h.key.To)
+	h.def.swap(func(s *definitionSnapshot) {
+		funcMap := s.hookMap(h.key.Kind)
+		hooks := funcMap[key]
+		for i, hook := range hooks {
+			if hook != h {
+				continue
+			}
+			// never remove in place, the backing array is shared with the previous snapshot
+			rest := append(append(make([]*HookRegistration, 0, len(hooks)-1), hooks[:i]...), hooks[i+1:]...)
+			if len(rest) == 0 {
+				delete(funcMap, key)
+			} else {
+				funcMap[key] = rest
+			}
+			return
+		}
+	})
+	h.def.logger.Debug("Transition function removed",
+		Field{Key: FieldState, Value: h.key.From},
+		Field{Key: FieldNextState, Value: h.key.To},
+	)
+}
+
+// AddPreCommitFunc add a pre-commit function (see RegisterPreCommitFunc) and return its handle
+func (def *Definition) AddPreCommitFunc(fromState, toState State, fn TransitionFunc) *HookRegistration {
+	return def.addHook(HookPreCommit, fromState, toState, fn)
+}
+
+// AddPostTransitionFunc add a post transition function (see RegisterPostTransitionFunc) and return its handle
+func (def *Definition) AddPostTransitionFunc(fromState, toState State, fn TransitionFunc) *HookRegistration {
+	return def.addHook(HookPostTransition, fromState, toState, fn)
+}
+
+// AddPreCommitFunc add a pre-commit function to FSM definition and return its handle
+func (fsm *Fsm) AddPreCommitFunc(fromState, toState State, fn TransitionFunc) *HookRegistration {
+	return fsm.def.AddPreCommitFunc(fromState, toState, fn)
+}
+
+// AddPostTransitionFunc add a post transition function to FSM definition and return its handle
+func (fsm *Fsm) AddPostTransitionFunc(fromState, toState State, fn TransitionFunc) *HookRegistration {
+	return fsm.def.AddPostTransitionFunc(fromState, toState, fn)
+}
+
+func (def *Definition) addHook(kind HookKind, fromState, toState State, fn TransitionFunc) *HookRegistration {
+	h := def.newHook(kind, fromState, toState, fn)
+	def.swap(h.add)
+	return h
+}
+
+func (def *Definition) newHook(kind HookKind, fromState, toState State, fn TransitionFunc) *HookRegistration {
+	return &HookRegistration{def: def, key: HookKey{Kind: kind, From: fromState, To: toState}, fn: fn}
+}
+
+// add the transition function to the snapshot
+func (h *HookRegistration) add(s *definitionSnapshot) {
+	key := newTransitionKey(h.key.From, h.key.To)
+	funcMap := s.hookMap(h.key.Kind)
+	hooks := funcMap[key]
+	// never append in place, the backing array is shared with the previous snapshot
+	funcMap[key] = append(hooks[:len(hooks):len(hooks)], h)
+}
+
+// transition functions of the kind
+func (s *definitionSnapshot) hookMap(kind HookKind) map[transitionKey][]*HookRegistration {
+	if kind == HookPreCommit {
+		return s.preCommitFuncMap
+	}
+	return s.postTransitionFuncMap
+}
@@ -0,0 +1,144 @@
+package go_fsm
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookRegistration_Unregister(t *testing.T) {
+	// post transition functions are called concurrently
+	var mu sync.Mutex
+	var calls []string
+	hook := func(name string) TransitionFunc {
+		return func(from, to State, fsmCtx FsmContext) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	fsm, err := NewDefinition().
+		When("idle", emptyStateActionFunc("idle")).
+		NewInstance("idle")
+	assert.NoError(t, err)
+
+	first := fsm.AddPostTransitionFunc("idle", "*", hook("first"))
+	second := fsm.AddPostTransitionFunc("idle", "*", hook("second"))
+	preCommit := fsm.AddPreCommitFunc("*", "idle", hook("pre commit"))
+	assert.Equal(t, HookKey{Kind: HookPreCommit, From: "*", To: "idle"}, preCommit.Key())
+	assert.Equal(t, []HookKey{preCommit.Key(), first.Key()}, fsm.Hooks())
+
+	assert.NoError(t, fsm.ProcessEvent("tick", nil))
+	assert.ElementsMatch(t, []string{"pre commit", "first", "second"}, calls)
+
+	first.Unregister()
+	preCommit.Unregister()
+	// the second call is ignored
+	first.Unregister()
+	assert.Equal(t, []HookKey{second.Key()}, fsm.Hooks())
+
+	calls = nil
+	assert.NoError(t, fsm.ProcessEvent("tick", nil))
+	assert.Equal(t, []string{"second"}, calls)
+
+	second.Unregister()
+	assert.Empty(t, fsm.Hooks())
+	calls = nil
+	assert.NoError(t, fsm.ProcessEvent("tick", nil))
+	assert.Empty(t, calls)
+}
+
+func TestHookRegistration_Unregister_Snapshot(t *testing.T) {
+	def := NewDefinition().When("idle", nil)
+	_, err := def.NewInstance("idle")
+	assert.NoError(t, err)
+	before := def.load()
+	h := def.AddPostTransitionFunc("idle", "idle", func(from, to State, fsmCtx FsmContext) error {
+		return nil
+	})
+	def.AddPostTransitionFunc("idle", "idle", func(from, to State, fsmCtx FsmContext) error {
+		return nil
+	})
+	registered := def.load()
+	h.Unregister()
+
+	key := newTransitionKey("idle", "idle")
+	assert.Len(t, before.postTransitionFuncMap[key], 0)
+	assert.Len(t, registered.postTransitionFuncMap[key], 2)
+	assert.Len(t, def.load().postTransitionFuncMap[key], 1)
+}
+
+func TestDefinition_ReplaceAction(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var hookCalls int32
+	def := NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (State, FsmContext, error) {
+			close(started)
+			<-release
+			return "running", fsmCtx, nil
+		}).
+		When("running", emptyStateActionFunc("idle")).
+		When("stopped", emptyStateActionFunc("stopped"))
+	h := def.AddPostTransitionFunc("idle", "running", func(from, to State, fsmCtx FsmContext) error {
+		atomic.AddInt32(&hookCalls, 1)
+		return nil
+	})
+	fsm, err := def.NewInstance("idle")
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- fsm.ProcessEvent("start", nil)
+	}()
+	<-started
+	assert.NoError(t, def.ReplaceAction("idle", emptyStateActionFunc("stopped")))
+	h.Unregister()
+	close(release)
+
+	// the event which is being processed uses the previous action and transition function
+	assert.NoError(t, <-done)
+	assert.Equal(t, "running", fsm.CurrentState())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hookCalls))
+
+	assert.NoError(t, fsm.ProcessEvent("stop", nil))
+	// the following events use the new definition
+	assert.NoError(t, fsm.ProcessEvent("start", nil))
+	assert.Equal(t, "stopped", fsm.CurrentState())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hookCalls))
+
+	err = fsm.ReplaceAction("unknown", emptyStateActionFunc("idle"))
+	assert.True(t, errors.Is(err, ErrUnknownState))
+	assert.EqualError(t, err, "unknown state [unknown]")
+	assert.False(t, def.load().isStateExists("unknown"))
+}
+
+func TestDefinition_ConcurrentChanges(t *testing.T) {
+	def := NewDefinition().
+		When("idle", emptyStateActionFunc("running")).
+		When("running", emptyStateActionFunc("idle"))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		fsm, err := def.NewInstance("idle")
+		assert.NoError(t, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.NoError(t, fsm.ProcessEvent("toggle", nil))
+			}
+		}()
+	}
+	for j := 0; j < 100; j++ {
+		assert.NoError(t, def.ReplaceAction("running", emptyStateActionFunc("idle")))
+		def.AddPostTransitionFunc("*", "*", func(from, to State, fsmCtx FsmContext) error {
+			return nil
+		}).Unregister()
+	}
+	wg.Wait()
+	assert.Empty(t, def.Hooks())
+}
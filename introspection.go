@@ -0,0 +1,120 @@
+package go_fsm
+
+import "sort"
+
+// States return registered states in alphabetical order, including states registered only as targets of transitions
+func (def *Definition) States() []State {
+	s := def.load()
+	states := make([]State, 0, len(s.actionMap))
+	for state := range s.actionMap {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	return states
+}
+
+// Transitions return declarative transitions in order of registration
+func (def *Definition) Transitions() []Transition {
+	transitions := def.load().transitions
+	return append(make([]Transition, 0, len(transitions)), transitions...)
+}
+
+// AvailableEvents return events which have declarative transitions from the state or all-state actions,
+// in alphabetical order. Events handled by action functions of the state or by the unhandled event action
+// are not known, guards are not evaluated (see Fsm.CanProcess).
+func (def *Definition) AvailableEvents(state State) []Event {
+	s := def.load()
+	seen := map[Event]bool{}
+	var events []Event
+	add := func(event Event) {
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+
+	for _, t := range s.transitions {
+		if t.From == state {
+			add(t.Event)
+		}
+	}
+	for event := range s.anyStateActionMap {
+		add(event)
+	}
+	sort.Strings(events)
+	return events
+}
+
+// Hooks return keys of registered transition functions in order of their calls: exit, entry, pre-commit and
+// post transition functions, each kind is ordered by states
+func (def *Definition) Hooks() []HookKey {
+	s := def.load()
+	hooks := stateHookKeys(HookExit, s.exitFuncMap, nil)
+	hooks = append(hooks, stateHookKeys(HookEntry, s.entryFuncMap, nil)...)
+	hooks = append(hooks, hookKeys(HookPreCommit, s.preCommitFuncMap, nil)...)
+	return append(hooks, hookKeys(HookPostTransition, s.postTransitionFuncMap, nil)...)
+}
+
+// InitialState return the state FSM was initialized with
+func (fsm *Fsm) InitialState() State {
+	return fsm.initialState
+}
+
+// States return registered states of FSM definition (see Definition.States)
+func (fsm *Fsm) States() []State {
+	return fsm.def.States()
+}
+
+// Transitions return declarative transitions of FSM definition (see Definition.Transitions)
+func (fsm *Fsm) Transitions() []Transition {
+	return fsm.def.Transitions()
+}
+
+// AvailableEvents return events known to be handled in the state (see Definition.AvailableEvents)
+func (fsm *Fsm) AvailableEvents(state State) []Event {
+	return fsm.def.AvailableEvents(state)
+}
+
+// Hooks return keys of transition functions of FSM definition (see Definition.Hooks)
+func (fsm *Fsm) Hooks() []HookKey {
+	return fsm.def.Hooks()
+}
+
+// keys of the kind which have transition functions and match the filter (nil matches all keys), ordered by source and target states
+func hookKeys(kind HookKind, funcMap map[transitionKey][]*HookRegistration, filter func(transitionKey) bool) []HookKey {
+	var keys []HookKey
+	for key, fns := range funcMap {
+		if len(fns) > 0 && (filter == nil || filter(key)) {
+			keys = append(keys, HookKey{Kind: kind, From: key.from, To: key.to})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].From != keys[j].From {
+			return keys[i].From < keys[j].From
+		}
+		return keys[i].To < keys[j].To
+	})
+	return keys
+}
+
+// keys of entry or exit functions of states which match the filter (nil matches all states), ordered by states
+func stateHookKeys(kind HookKind, funcMap map[State][]TransitionFunc, filter func(State) bool) []HookKey {
+	states := make([]State, 0, len(funcMap))
+	for state, fns := range funcMap {
+		if len(fns) > 0 && (filter == nil || filter(state)) {
+			states = append(states, state)
+		}
+	}
+	sort.Strings(states)
+
+	keys := make([]HookKey, len(states))
+	for i, state := range states {
+		keys[i] = HookKey{Kind: kind}
+		if kind == HookEntry {
+			keys[i].To = state
+		} else {
+			keys[i].From = state
+		}
+	}
+	return keys
+}
@@ -0,0 +1,61 @@
+package go_fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefinition_Introspection(t *testing.T) {
+	hook := func(from, to State, fsmCtx FsmContext) error {
+		return nil
+	}
+	def := NewDefinition().
+		When("idle", nil).
+		When("paused", emptyStateActionFunc("idle")).
+		On("idle", "start", "running").
+		On("idle", "start", "failed", GuardOption("broken", func(eventCtx EventContext, fsmCtx FsmContext) bool {
+			return false
+		})).
+		On("running", "stop", "idle").
+		On("running", "pause", "paused").
+		WhenAny("reset", emptyStateActionFunc("idle")).
+		RegisterPostTransitionFunc("*", "idle", hook).
+		RegisterPostTransitionFunc("idle", "running", hook).
+		RegisterPostTransitionFunc("idle", "running", hook).
+		RegisterPreCommitFunc("running", "*", hook)
+
+	assert.Equal(t, []State{"failed", "idle", "paused", "running"}, def.States())
+	assert.Equal(t, []Event{"reset", "start"}, def.AvailableEvents("idle"))
+	assert.Equal(t, []Event{"pause", "reset", "stop"}, def.AvailableEvents("running"))
+	assert.Equal(t, []Event{"reset"}, def.AvailableEvents("unknown"))
+	assert.Equal(t, []HookKey{
+		{Kind: HookPreCommit, From: "running", To: "*"},
+		{Kind: HookPostTransition, From: "*", To: "idle"},
+		{Kind: HookPostTransition, From: "idle", To: "running"},
+	}, def.Hooks())
+
+	transitions := def.Transitions()
+	assert.Len(t, transitions, 4)
+	assert.Equal(t, "broken", transitions[1].GuardName)
+	// the returned slice is a copy
+	transitions[0].To = "changed"
+	assert.Equal(t, "running", def.Transitions()[0].To)
+
+	fsm, err := def.NewInstance("idle")
+	assert.NoError(t, err)
+	assert.NoError(t, fsm.ProcessEvent("start", nil))
+	assert.Equal(t, "idle", fsm.InitialState())
+	assert.Equal(t, def.States(), fsm.States())
+	assert.Len(t, fsm.Transitions(), 4)
+	assert.Equal(t, def.AvailableEvents("running"), fsm.AvailableEvents("running"))
+	assert.Equal(t, def.Hooks(), fsm.Hooks())
+}
+
+func TestDefinition_Introspection_Empty(t *testing.T) {
+	def := NewDefinition()
+	assert.Empty(t, def.States())
+	assert.Empty(t, def.Transitions())
+	assert.Empty(t, def.AvailableEvents("idle"))
+	assert.Empty(t, def.Hooks())
+}
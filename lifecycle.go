@@ -0,0 +1,204 @@
+package go_fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// Status is a lifecycle status of FSM instance
+type Status int
+
+const (
+	// StatusCreated FSM is created but not initialized yet
+	StatusCreated Status = iota
+	// StatusRunning FSM accepts events
+	StatusRunning
+	// StatusClosed FSM has been closed by its owner
+	StatusClosed
+	// StatusTerminated FSM has entered a final state
+	StatusTerminated
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusCreated:
+		return "created"
+	case StatusRunning:
+		return "running"
+	case StatusClosed:
+		return "closed"
+	case StatusTerminated:
+		return "terminated"
+	default:
+		return "unknown"
+	}
+}
+
+// close reasons
+const (
+	// ReasonClosed is a reason of Close
+	ReasonClosed TerminateReason = "closed"
+	// ReasonShutdown means that the owner (Registry or Supervisor) shuts down
+	ReasonShutdown TerminateReason = "shutdown"
+	// ReasonRestart means that Supervisor restarts FSM
+	ReasonRestart TerminateReason = "restart"
+	// ReasonPassivated means that Registry has evicted FSM to its store
+	ReasonPassivated TerminateReason = "passivated"
+	// ReasonCanceled means that the parent context of FSM is done
+	ReasonCanceled TerminateReason = "canceled"
+)
+
+//Status return FSM lifecycle status, FSM whose parent context is done is closed
+func (fsm Fsm) Status() Status {
+	if fsm.isCanceled() {
+		return StatusClosed
+	}
+	return fsm.status
+}
+
+//Reason return the reason of termination or close, it's empty for a running FSM
+func (fsm Fsm) Reason() TerminateReason {
+	if fsm.isCanceled() {
+		return ReasonCanceled
+	}
+	return fsm.reason
+}
+
+// running FSM whose parent context is done, it isn't released until the owner calls it again
+func (fsm Fsm) isCanceled() bool {
+	return fsm.status == StatusRunning && fsm.parent != nil && fsm.parent.Err() != nil
+}
+
+// release FSM whose parent context is done, terminate functions are called with ReasonCanceled.
+// FSM isn't safe for concurrent use, so the watcher of the parent context only closes Done channel
+// and FSM is released by the next call of its owner.
+func (fsm *Fsm) closeIfCanceled() {
+	if fsm.isCanceled() {
+		fsm.CloseWithReason(ReasonCanceled)
+	}
+}
+
+// close Done channel when the parent context is done, the watcher stops when FSM is stopped
+func (fsm *Fsm) watchParent(parent context.Context) {
+	if parent.Done() == nil {
+		return
+	}
+	// FSM context is done when the parent is done or FSM is stopped
+	stopped, done := fsm.ctx.Done(), fsm.done
+	go func() {
+		<-stopped
+		if parent.Err() != nil {
+			done.close()
+		}
+	}()
+}
+
+// channel which can be closed concurrently by FSM and the watcher of its parent context
+type doneChannel struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newDoneChannel() *doneChannel {
+	return &doneChannel{ch: make(chan struct{})}
+}
+
+func (d *doneChannel) close() {
+	d.once.Do(func() {
+		close(d.ch)
+	})
+}
+
+func (d *doneChannel) isClosed() bool {
+	select {
+	case <-d.ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// ResetOption configures Fsm.ResetWith
+type ResetOption func(*resetOptions)
+
+type resetOptions struct {
+	state    State
+	keepKeys []interface{}
+}
+
+// ResetStateOption reset FSM to the state instead of the initial state
+func ResetStateOption(state State) ResetOption {
+	return func(o *resetOptions) {
+		o.state = state
+	}
+}
+
+// KeepDataOption keep values of FSM context with the keys, other values are dropped
+func KeepDataOption(keys ...interface{}) ResetOption {
+	return func(o *resetOptions) {
+		o.keepKeys = append(o.keepKeys, keys...)
+	}
+}
+
+//ResetWith reset FSM to the initial (or the given) state and a new context derived from the parent context,
+//selected context values can be kept. Subscriptions are kept, a closed or terminated FSM is running again.
+func (fsm *Fsm) ResetWith(opts ...ResetOption) error {
+	options := resetOptions{state: fsm.initialState}
+	for _, o := range opts {
+		o(&options)
+	}
+	if err := fsm.def.validateInitialState(options.state); err != nil {
+		return err
+	}
+
+	parent := fsm.parent
+	if parent == nil {
+		parent = context.Background()
+	}
+	for _, key := range options.keepKeys {
+		if value := fsm.valueOf(key); value != nil {
+			parent = context.WithValue(parent, key, value)
+		}
+	}
+
+	fsm.stop()
+	fsm.start(parent, options.state)
+	fsm.logger.Info("FSM has reset", Field{Key: FieldState, Value: fsm.state})
+	return nil
+}
+
+// value of the current FSM context, it's nil if FSM has not been initialized
+func (fsm *Fsm) valueOf(key interface{}) interface{} {
+	if fsm.ctx == nil {
+		return nil
+	}
+	return fsm.ctx.Value(key)
+}
+
+//CloseWithReason close FSM, terminate functions are called with the reason (ReasonCanceled if the parent
+//context is already done). It's idempotent: closing of a closed or terminated FSM does nothing.
+func (fsm *Fsm) CloseWithReason(reason TerminateReason) {
+	if fsm.isCanceled() {
+		reason = ReasonCanceled
+	}
+	switch fsm.status {
+	case StatusClosed, StatusTerminated:
+		return
+	case StatusRunning:
+		def := fsm.def.load()
+		for _, fn := range def.terminateFuncs {
+			fsm.callTerminateFunc(fn, reason)
+		}
+	}
+
+	fsm.release(StatusClosed, reason)
+	fsm.logger.Info("FSM has closed", Field{Key: FieldState, Value: fsm.state}, Field{Key: FieldReason, Value: reason})
+}
+
+// stop FSM and close subscriptions and Done channel, terminate functions are not called
+func (fsm *Fsm) release(status Status, reason TerminateReason) {
+	fsm.stop()
+	fsm.status, fsm.reason = status, reason
+	fsm.subscribers.close()
+	fsm.closeDone()
+}
@@ -0,0 +1,123 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsm_InitWithContext(t *testing.T) {
+	var reasons []TerminateReason
+	metrics := newTestMetrics()
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), testCtxKey("tenant"), "acme"))
+	fsm, err := NewFsm(MetricsOption(metrics)).
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			assert.Equal(t, "acme", fsmCtx.Value(testCtxKey("tenant")))
+			return "idle", nil, nil
+		}).
+		OnTerminate(func(reason TerminateReason, state State, fsmCtx FsmContext) {
+			reasons = append(reasons, reason)
+		}).
+		InitWithContext(parent, "idle")
+	assert.NoError(t, err)
+	assert.NoError(t, fsm.ProcessEvent("go", nil))
+
+	// FSM inherits cancellation of the parent and it's closed
+	cancel()
+	select {
+	case <-fsm.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done channel is not closed")
+	}
+	assert.Equal(t, StatusClosed, fsm.Status())
+	assert.Equal(t, ReasonCanceled, fsm.Reason())
+	assert.True(t, errors.Is(fsm.ProcessEvent("go", nil), ErrClosed))
+	assert.Equal(t, []TerminateReason{ReasonCanceled}, reasons)
+	assert.Equal(t, 0, metrics.instances["idle"])
+	fsm.Close()
+	assert.Equal(t, ReasonCanceled, fsm.Reason())
+	assert.Len(t, reasons, 1)
+
+	_, err = NewFsm().InitWithContext(parent, "unknown")
+	assert.EqualError(t, err, "invalid initial state [unknown]")
+}
+
+func TestFsm_InitWithContext_Reinit(t *testing.T) {
+	metrics := newTestMetrics()
+	fsm, err := NewFsm(MetricsOption(metrics)).
+		When("idle", emptyStateActionFunc("idle")).
+		When("running", emptyStateActionFunc("running")).
+		InitWithState("idle")
+	assert.NoError(t, err)
+	ctx := fsm.ctx
+
+	_, err = fsm.InitWithState("running")
+	assert.NoError(t, err)
+	assert.Error(t, ctx.Err())
+	assert.Equal(t, 0, metrics.instances["idle"])
+	assert.Equal(t, 1, metrics.instances["running"])
+	assert.Equal(t, StatusRunning, fsm.Status())
+}
+
+func TestFsm_Lifecycle(t *testing.T) {
+	var reasons []TerminateReason
+	metrics := newTestMetrics()
+	fsm := NewFsm(MetricsOption(metrics)).
+		When("idle", emptyStateActionFunc("idle")).
+		OnTerminate(func(reason TerminateReason, state State, fsmCtx FsmContext) {
+			reasons = append(reasons, reason)
+		})
+	assert.Equal(t, StatusCreated, fsm.Status())
+	assert.True(t, errors.Is(fsm.ProcessEvent("go", nil), ErrNotInitialized))
+
+	_, err := fsm.InitWithState("idle")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRunning, fsm.Status())
+	assert.Equal(t, "running", fsm.Status().String())
+	assert.Empty(t, fsm.Reason())
+
+	fsm.CloseWithReason("maintenance")
+	fsm.Close()
+	assert.Equal(t, StatusClosed, fsm.Status())
+	assert.Equal(t, "maintenance", fsm.Reason())
+	assert.Equal(t, []TerminateReason{"maintenance"}, reasons)
+	assert.Equal(t, 0, metrics.instances["idle"])
+	assert.True(t, errors.Is(fsm.ProcessEvent("go", nil), ErrClosed))
+
+	// never initialized FSM can be closed as well
+	created := NewFsm()
+	created.Close()
+	assert.Equal(t, StatusClosed, created.Status())
+	<-created.Done()
+}
+
+func TestFsm_ResetWith(t *testing.T) {
+	parent := context.WithValue(context.Background(), testCtxKey("tenant"), "acme")
+	fsm, err := NewFsm().
+		On("idle", "go", "running", TransitionActionOption(func(eventCtx EventContext, fsmCtx FsmContext) (FsmContext, error) {
+			ctx := context.WithValue(fsmCtx, testCtxKey("user"), "bob")
+			return context.WithValue(ctx, testCtxKey("cart"), "items"), nil
+		})).
+		On("running", "stop", "idle").
+		InitWithContext(parent, "idle")
+	assert.NoError(t, err)
+	assert.NoError(t, fsm.ProcessEvent("go", nil))
+
+	assert.NoError(t, fsm.ResetWith(ResetStateOption("running"), KeepDataOption(testCtxKey("user"), testCtxKey("unknown"))))
+	assert.Equal(t, "running", fsm.CurrentState())
+	assert.Equal(t, "bob", fsm.ctx.Value(testCtxKey("user")))
+	assert.Nil(t, fsm.ctx.Value(testCtxKey("cart")))
+	assert.Equal(t, "acme", fsm.ctx.Value(testCtxKey("tenant")))
+
+	assert.EqualError(t, fsm.ResetWith(ResetStateOption("unknown")), "invalid initial state [unknown]")
+	assert.Equal(t, "running", fsm.CurrentState())
+
+	fsm.Close()
+	assert.NoError(t, fsm.Reset())
+	assert.Equal(t, StatusRunning, fsm.Status())
+	assert.Equal(t, "idle", fsm.CurrentState())
+	assert.Nil(t, fsm.ctx.Value(testCtxKey("user")))
+}
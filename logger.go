@@ -1,11 +1,67 @@
 package go_fsm
 
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
 // Logger is a generic logging interface
 type Logger interface {
 	Log(v ...interface{})
 	Logf(format string, v ...interface{})
 }
 
+// Level is a logging level of a structured message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// common field keys
+const (
+	FieldFsmID     = "fsm_id"
+	FieldState     = "state"
+	FieldEvent     = "event"
+	FieldNextState = "next_state"
+	FieldError     = "error"
+	FieldReason    = "reason"
+)
+
+// Field is a key/value pair attached to a structured log message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// StructuredLogger is a leveled logging interface with key/value fields
+type StructuredLogger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
 // Nil logger adapter (logging nothing)
 type nilLoggerAdapter struct {
 }
@@ -15,3 +71,132 @@ func (n *nilLoggerAdapter) Log(v ...interface{}) {
 
 func (n *nilLoggerAdapter) Logf(format string, v ...interface{}) {
 }
+
+func (n *nilLoggerAdapter) Debug(msg string, fields ...Field) {
+}
+
+func (n *nilLoggerAdapter) Info(msg string, fields ...Field) {
+}
+
+func (n *nilLoggerAdapter) Warn(msg string, fields ...Field) {
+}
+
+func (n *nilLoggerAdapter) Error(msg string, fields ...Field) {
+}
+
+// leveledLogger implements StructuredLogger on top of a single output function
+type leveledLogger struct {
+	minLevel Level
+	output   func(level Level, msg string, fields []Field)
+}
+
+func (l *leveledLogger) log(level Level, msg string, fields []Field) {
+	if level >= l.minLevel {
+		l.output(level, msg, fields)
+	}
+}
+
+func (l *leveledLogger) Debug(msg string, fields ...Field) {
+	l.log(LevelDebug, msg, fields)
+}
+
+func (l *leveledLogger) Info(msg string, fields ...Field) {
+	l.log(LevelInfo, msg, fields)
+}
+
+func (l *leveledLogger) Warn(msg string, fields ...Field) {
+	l.log(LevelWarn, msg, fields)
+}
+
+func (l *leveledLogger) Error(msg string, fields ...Field) {
+	l.log(LevelError, msg, fields)
+}
+
+// NewLoggerAdapter wrap the legacy Logger into StructuredLogger,
+// messages are formatted as logfmt line and passed to Logger.Log
+func NewLoggerAdapter(logger Logger, minLevel Level) StructuredLogger {
+	return &leveledLogger{
+		minLevel: minLevel,
+		output: func(level Level, msg string, fields []Field) {
+			logger.Log(formatLogLine(level, msg, fields))
+		},
+	}
+}
+
+// NewStdLogAdapter create StructuredLogger which writes logfmt lines to the standard library logger
+func NewStdLogAdapter(logger *log.Logger, minLevel Level) StructuredLogger {
+	return &leveledLogger{
+		minLevel: minLevel,
+		output: func(level Level, msg string, fields []Field) {
+			logger.Print(formatLogLine(level, msg, fields))
+		},
+	}
+}
+
+// fieldsLogger adds predefined fields to every message
+type fieldsLogger struct {
+	logger StructuredLogger
+	fields []Field
+}
+
+func withFields(logger StructuredLogger, fields ...Field) StructuredLogger {
+	if _, ok := logger.(*nilLoggerAdapter); ok {
+		return logger
+	}
+	return &fieldsLogger{logger: logger, fields: fields}
+}
+
+func (l *fieldsLogger) with(fields []Field) []Field {
+	return append(l.fields[:len(l.fields):len(l.fields)], fields...)
+}
+
+func (l *fieldsLogger) Debug(msg string, fields ...Field) {
+	l.logger.Debug(msg, l.with(fields)...)
+}
+
+func (l *fieldsLogger) Info(msg string, fields ...Field) {
+	l.logger.Info(msg, l.with(fields)...)
+}
+
+func (l *fieldsLogger) Warn(msg string, fields ...Field) {
+	l.logger.Warn(msg, l.with(fields)...)
+}
+
+func (l *fieldsLogger) Error(msg string, fields ...Field) {
+	l.logger.Error(msg, l.with(fields)...)
+}
+
+// format message as logfmt line e.g. level=INFO msg="FSM initialized" state=idle
+func formatLogLine(level Level, msg string, fields []Field) string {
+	b := new(strings.Builder)
+	b.WriteString("level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(formatLogValue(msg))
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(formatLogValue(f.Value))
+	}
+	return b.String()
+}
+
+func formatLogValue(v interface{}) string {
+	var s string
+	switch value := v.(type) {
+	case string:
+		s = value
+	case error:
+		s = value.Error()
+	case fmt.Stringer:
+		s = value.String()
+	default:
+		s = fmt.Sprint(value)
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\n\t") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+//go:build go1.21
+// +build go1.21
+
+package go_fsm
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogAdapter writes structured messages to log/slog logger
+type slogAdapter struct {
+	logger *slog.Logger
+}
+
+// NewSlogAdapter create StructuredLogger backed by log/slog logger
+func NewSlogAdapter(logger *slog.Logger) StructuredLogger {
+	return &slogAdapter{logger: logger}
+}
+
+func (a *slogAdapter) log(level slog.Level, msg string, fields []Field) {
+	ctx := context.Background()
+	if !a.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		if err, ok := f.Value.(error); ok {
+			attrs[i] = slog.String(f.Key, err.Error())
+			continue
+		}
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	a.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (a *slogAdapter) Debug(msg string, fields ...Field) {
+	a.log(slog.LevelDebug, msg, fields)
+}
+
+func (a *slogAdapter) Info(msg string, fields ...Field) {
+	a.log(slog.LevelInfo, msg, fields)
+}
+
+func (a *slogAdapter) Warn(msg string, fields ...Field) {
+	a.log(slog.LevelWarn, msg, fields)
+}
+
+func (a *slogAdapter) Error(msg string, fields ...Field) {
+	a.log(slog.LevelError, msg, fields)
+}
@@ -0,0 +1,36 @@
+//go:build go1.21
+// +build go1.21
+
+package go_fsm
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSlogAdapter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	handler := slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	logger := NewSlogAdapter(slog.New(handler))
+
+	logger.Debug("skipped")
+	logger.Info("FSM initialized", Field{Key: FieldState, Value: "idle"})
+	logger.Warn("warn", Field{Key: FieldError, Value: errors.New("some error")})
+	logger.Error("error")
+
+	assert.Equal(t, "level=INFO msg=\"FSM initialized\" state=idle\n"+
+		"level=WARN msg=warn error=\"some error\"\n"+
+		"level=ERROR msg=error\n", buf.String())
+}
@@ -0,0 +1,120 @@
+package go_fsm
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// structured logger which keeps formatted messages
+type recordingLogger struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (l *recordingLogger) record(level Level, msg string, fields []Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = append(l.log, formatLogLine(level, msg, fields))
+}
+
+func (l *recordingLogger) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.log...)
+}
+
+func (l *recordingLogger) Debug(msg string, fields ...Field) {
+	l.record(LevelDebug, msg, fields)
+}
+
+func (l *recordingLogger) Info(msg string, fields ...Field) {
+	l.record(LevelInfo, msg, fields)
+}
+
+func (l *recordingLogger) Warn(msg string, fields ...Field) {
+	l.record(LevelWarn, msg, fields)
+}
+
+func (l *recordingLogger) Error(msg string, fields ...Field) {
+	l.record(LevelError, msg, fields)
+}
+
+// legacy logger which keeps messages
+type legacyRecordingLogger struct {
+	log []string
+}
+
+func (l *legacyRecordingLogger) Log(v ...interface{}) {
+	for _, value := range v {
+		l.log = append(l.log, value.(string))
+	}
+}
+
+func (l *legacyRecordingLogger) Logf(format string, v ...interface{}) {
+}
+
+func TestLevel_String(t *testing.T) {
+	assert.Equal(t, "DEBUG", LevelDebug.String())
+	assert.Equal(t, "INFO", LevelInfo.String())
+	assert.Equal(t, "WARN", LevelWarn.String())
+	assert.Equal(t, "ERROR", LevelError.String())
+	assert.Equal(t, "LEVEL(10)", Level(10).String())
+}
+
+func TestNewLoggerAdapter(t *testing.T) {
+	legacy := &legacyRecordingLogger{}
+	logger := NewLoggerAdapter(legacy, LevelInfo)
+	logger.Debug("skipped")
+	logger.Info("info", Field{Key: FieldState, Value: "idle"})
+	logger.Warn("warn")
+	logger.Error("error", Field{Key: FieldError, Value: errors.New("some error")})
+
+	assert.Equal(t, []string{
+		"level=INFO msg=info state=idle",
+		"level=WARN msg=warn",
+		`level=ERROR msg=error error="some error"`,
+	}, legacy.log)
+}
+
+func TestNewStdLogAdapter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewStdLogAdapter(log.New(buf, "", 0), LevelDebug)
+	logger.Debug("Handling event", Field{Key: FieldEvent, Value: "start"}, Field{Key: "attempt", Value: 2})
+	assert.Equal(t, "level=DEBUG msg=\"Handling event\" event=start attempt=2\n", buf.String())
+}
+
+func Test_withFields(t *testing.T) {
+	t.Run("Nil logger", func(t *testing.T) {
+		logger := &nilLoggerAdapter{}
+		assert.Equal(t, logger, withFields(logger, Field{Key: FieldFsmID, Value: "id"}))
+	})
+
+	t.Run("Fields are prepended", func(t *testing.T) {
+		recorder := &recordingLogger{}
+		logger := withFields(recorder, Field{Key: FieldFsmID, Value: "id"})
+		logger.Debug("debug", Field{Key: FieldState, Value: "a"})
+		logger.Info("info", Field{Key: FieldState, Value: "b"})
+		logger.Warn("warn")
+		logger.Error("error")
+		assert.Equal(t, []string{
+			"level=DEBUG msg=debug fsm_id=id state=a",
+			"level=INFO msg=info fsm_id=id state=b",
+			"level=WARN msg=warn fsm_id=id",
+			"level=ERROR msg=error fsm_id=id",
+		}, recorder.lines())
+	})
+}
+
+func Test_formatLogValue(t *testing.T) {
+	assert.Equal(t, "idle", formatLogValue("idle"))
+	assert.Equal(t, `""`, formatLogValue(""))
+	assert.Equal(t, `"a b"`, formatLogValue("a b"))
+	assert.Equal(t, `"a=b"`, formatLogValue("a=b"))
+	assert.Equal(t, "10", formatLogValue(10))
+	assert.Equal(t, "DEBUG", formatLogValue(LevelDebug))
+}
@@ -0,0 +1,273 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ErrorKind = string
+
+const (
+	ErrorKindActionNotFound   ErrorKind = "action_not_found"
+	ErrorKindUnknownNextState ErrorKind = "unknown_next_state"
+	ErrorKindNotHandled       ErrorKind = "not_handled"
+	ErrorKindClosed           ErrorKind = "closed"
+	ErrorKindTerminated       ErrorKind = "terminated"
+	ErrorKindNotInitialized   ErrorKind = "not_initialized"
+	ErrorKindContext          ErrorKind = "context"
+	ErrorKindAction           ErrorKind = "action"
+	ErrorKindPanic            ErrorKind = "panic"
+)
+
+// DefaultLatencyBuckets are histogram upper bounds (in seconds) used by built-in metrics implementations
+var DefaultLatencyBuckets = []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics is an interface which FSM calls during event processing to collect metrics
+type Metrics interface {
+	// EventProcessed is called for each event passed to ProcessEvent
+	EventProcessed(state State, event Event)
+	// ErrorOccurred is called when ProcessEvent returns an error
+	ErrorOccurred(kind ErrorKind, state State, event Event)
+	// ObserveAction reports how long the action function of the state took
+	ObserveAction(state State, event Event, d time.Duration)
+	// ObserveTransitionFunc reports how long an exit, entry, pre-commit or post transition function took
+	ObserveTransitionFunc(from, to State, d time.Duration)
+	// StateEntered and StateExited are used to track the number of FSM instances per state
+	StateEntered(state State)
+	StateExited(state State)
+}
+
+// Nil metrics adapter (collecting nothing)
+type nilMetricsAdapter struct {
+}
+
+func (n *nilMetricsAdapter) EventProcessed(state State, event Event) {
+}
+
+func (n *nilMetricsAdapter) ErrorOccurred(kind ErrorKind, state State, event Event) {
+}
+
+func (n *nilMetricsAdapter) ObserveAction(state State, event Event, d time.Duration) {
+}
+
+func (n *nilMetricsAdapter) ObserveTransitionFunc(from, to State, d time.Duration) {
+}
+
+func (n *nilMetricsAdapter) StateEntered(state State) {
+}
+
+func (n *nilMetricsAdapter) StateExited(state State) {
+}
+
+// classify error returned by ProcessEvent
+func errorKindOf(err error) ErrorKind {
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return ErrorKindPanic
+	}
+
+	// errors may be wrapped by action functions, e.g. with TransitionError
+	switch {
+	case errors.Is(err, ErrActionNotFound):
+		return ErrorKindActionNotFound
+	case errors.Is(err, ErrUnknownNextState):
+		return ErrorKindUnknownNextState
+	case errors.Is(err, ErrNotHandled):
+		return ErrorKindNotHandled
+	case errors.Is(err, ErrClosed):
+		return ErrorKindClosed
+	case errors.Is(err, ErrTerminated):
+		return ErrorKindTerminated
+	case errors.Is(err, ErrNotInitialized):
+		return ErrorKindNotInitialized
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindContext
+	default:
+		return ErrorKindAction
+	}
+}
+
+// histogram with fixed upper bounds, safe for concurrent use
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// snapshot returns cumulative bucket counts, sum and total count of observations
+func (h *histogram) snapshot() (cumulative []uint64, sum float64, count uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cumulative = make([]uint64, len(h.counts))
+	var acc uint64
+	for i, c := range h.counts {
+		acc += c
+		cumulative[i] = acc
+	}
+
+	return cumulative, h.sum, h.count
+}
+
+// String implements expvar.Var interface
+func (h *histogram) String() string {
+	cumulative, sum, count := h.snapshot()
+
+	b := new(strings.Builder)
+	fmt.Fprintf(b, `{"count":%d,"sum":%s,"buckets":{`, count, formatFloat(sum))
+	for i, upper := range h.buckets {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, `"%s":%d`, formatFloat(upper), cumulative[i])
+	}
+	b.WriteString("}}")
+
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// histogramVec is a set of histograms partitioned by label values
+type histogramVec struct {
+	mu      sync.RWMutex
+	buckets []float64
+	series  map[string]*histogram
+	labels  map[string][]string
+}
+
+func newHistogramVec(buckets []float64) *histogramVec {
+	return &histogramVec{
+		buckets: buckets,
+		series:  map[string]*histogram{},
+		labels:  map[string][]string{},
+	}
+}
+
+func (v *histogramVec) with(values ...string) *histogram {
+	key := seriesKey(values)
+
+	v.mu.RLock()
+	h, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok = v.series[key]; !ok {
+		h = newHistogram(v.buckets)
+		v.series[key] = h
+		v.labels[key] = values
+	}
+
+	return h
+}
+
+// each iterates over all series sorted by label values
+func (v *histogramVec) each(fn func(values []string, h *histogram)) {
+	v.mu.RLock()
+	keys := sortedKeys(v.labels)
+	series := make([]*histogram, len(keys))
+	values := make([][]string, len(keys))
+	for i, key := range keys {
+		series[i], values[i] = v.series[key], v.labels[key]
+	}
+	v.mu.RUnlock()
+
+	for i := range keys {
+		fn(values[i], series[i])
+	}
+}
+
+// counterVec is a set of float counters (or gauges) partitioned by label values
+type counterVec struct {
+	mu     sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+func newCounterVec() *counterVec {
+	return &counterVec{
+		values: map[string]float64{},
+		labels: map[string][]string{},
+	}
+}
+
+func (v *counterVec) add(delta float64, values ...string) {
+	key := seriesKey(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.labels[key]; !ok {
+		v.labels[key] = values
+	}
+	v.values[key] += delta
+}
+
+func (v *counterVec) get(values ...string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.values[seriesKey(values)]
+}
+
+// each iterates over all series sorted by label values
+func (v *counterVec) each(fn func(values []string, value float64)) {
+	v.mu.Lock()
+	keys := sortedKeys(v.labels)
+	values := make([][]string, len(keys))
+	counts := make([]float64, len(keys))
+	for i, key := range keys {
+		values[i], counts[i] = v.labels[key], v.values[key]
+	}
+	v.mu.Unlock()
+
+	for i := range keys {
+		fn(values[i], counts[i])
+	}
+}
+
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
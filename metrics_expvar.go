@@ -0,0 +1,110 @@
+package go_fsm
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// ExpvarMetrics is a Metrics implementation backed by expvar package.
+// All variables are published as a single map under the given name:
+//
+//	events - received events count [state][event]
+//	errors - errors count [kind][state][event]
+//	instances - number of FSM instances [state]
+//	action_seconds - action functions latency histograms [state][event]
+//	transition_func_seconds - post transition functions latency histograms [from][to]
+type ExpvarMetrics struct {
+	mu sync.Mutex
+
+	root                  *expvar.Map
+	events                *expvar.Map
+	errors                *expvar.Map
+	instances             *expvar.Map
+	actionLatency         *expvar.Map
+	transitionFuncLatency *expvar.Map
+}
+
+// NewExpvarMetrics create expvar metrics and publish them with the given name.
+// As with expvar.Publish it panics if the name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := &ExpvarMetrics{
+		root:                  expvar.NewMap(name),
+		events:                new(expvar.Map).Init(),
+		errors:                new(expvar.Map).Init(),
+		instances:             new(expvar.Map).Init(),
+		actionLatency:         new(expvar.Map).Init(),
+		transitionFuncLatency: new(expvar.Map).Init(),
+	}
+
+	m.root.Set("events", m.events)
+	m.root.Set("errors", m.errors)
+	m.root.Set("instances", m.instances)
+	m.root.Set("action_seconds", m.actionLatency)
+	m.root.Set("transition_func_seconds", m.transitionFuncLatency)
+
+	return m
+}
+
+// Map returns the root expvar map
+func (m *ExpvarMetrics) Map() *expvar.Map {
+	return m.root
+}
+
+func (m *ExpvarMetrics) EventProcessed(state State, event Event) {
+	m.subMap(m.events, state).Add(event, 1)
+}
+
+func (m *ExpvarMetrics) ErrorOccurred(kind ErrorKind, state State, event Event) {
+	m.subMap(m.subMap(m.errors, kind), state).Add(event, 1)
+}
+
+func (m *ExpvarMetrics) ObserveAction(state State, event Event, d time.Duration) {
+	m.histogram(m.subMap(m.actionLatency, state), event).observe(d.Seconds())
+}
+
+func (m *ExpvarMetrics) ObserveTransitionFunc(from, to State, d time.Duration) {
+	m.histogram(m.subMap(m.transitionFuncLatency, from), to).observe(d.Seconds())
+}
+
+func (m *ExpvarMetrics) StateEntered(state State) {
+	m.instances.Add(state, 1)
+}
+
+func (m *ExpvarMetrics) StateExited(state State) {
+	m.instances.Add(state, -1)
+}
+
+// get or create nested map
+func (m *ExpvarMetrics) subMap(parent *expvar.Map, key string) *expvar.Map {
+	if v, ok := parent.Get(key).(*expvar.Map); ok {
+		return v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := parent.Get(key).(*expvar.Map); ok {
+		return v
+	}
+
+	v := new(expvar.Map).Init()
+	parent.Set(key, v)
+	return v
+}
+
+// get or create histogram in the map
+func (m *ExpvarMetrics) histogram(parent *expvar.Map, key string) *histogram {
+	if h, ok := parent.Get(key).(*histogram); ok {
+		return h
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if h, ok := parent.Get(key).(*histogram); ok {
+		return h
+	}
+
+	h := newHistogram(DefaultLatencyBuckets)
+	parent.Set(key, h)
+	return h
+}
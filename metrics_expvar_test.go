@@ -0,0 +1,35 @@
+package go_fsm
+
+import (
+	"expvar"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpvarMetrics(t *testing.T) {
+	// expvar names are global, so the name must be unique for every test run
+	name := fmt.Sprintf("go_fsm_test_metrics_%d", time.Now().UnixNano())
+	m := NewExpvarMetrics(name)
+	assert.Equal(t, m.Map(), expvar.Get(name))
+
+	m.EventProcessed("idle", "start")
+	m.EventProcessed("idle", "start")
+	m.ErrorOccurred(ErrorKindAction, "idle", "start")
+	m.ObserveAction("idle", "start", time.Millisecond)
+	m.ObserveTransitionFunc("idle", "running", time.Millisecond)
+	m.StateEntered("idle")
+	m.StateEntered("idle")
+	m.StateExited("idle")
+
+	assert.Equal(t, "2", m.events.Get("idle").(*expvar.Map).Get("start").String())
+	assert.Equal(t, "1", m.errors.Get(ErrorKindAction).(*expvar.Map).Get("idle").(*expvar.Map).Get("start").String())
+	assert.Equal(t, "1", m.instances.Get("idle").String())
+
+	_, _, count := m.actionLatency.Get("idle").(*expvar.Map).Get("start").(*histogram).snapshot()
+	assert.Equal(t, uint64(1), count)
+	_, _, count = m.transitionFuncLatency.Get("idle").(*expvar.Map).Get("running").(*histogram).snapshot()
+	assert.Equal(t, uint64(1), count)
+}
@@ -0,0 +1,158 @@
+package go_fsm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusMetrics is a dependency free Metrics implementation which exposes collected metrics
+// in Prometheus text exposition format. It implements http.Handler, so it can be mounted directly, e.g.
+//
+//	http.Handle("/metrics", metrics)
+type PrometheusMetrics struct {
+	namespace string
+
+	events                *counterVec
+	errors                *counterVec
+	instances             *counterVec
+	actionLatency         *histogramVec
+	transitionFuncLatency *histogramVec
+}
+
+// NewPrometheusMetrics create Prometheus metrics, all metric names are prefixed by the namespace (e.g. "fsm")
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		namespace:             namespace,
+		events:                newCounterVec(),
+		errors:                newCounterVec(),
+		instances:             newCounterVec(),
+		actionLatency:         newHistogramVec(DefaultLatencyBuckets),
+		transitionFuncLatency: newHistogramVec(DefaultLatencyBuckets),
+	}
+}
+
+func (m *PrometheusMetrics) EventProcessed(state State, event Event) {
+	m.events.add(1, state, event)
+}
+
+func (m *PrometheusMetrics) ErrorOccurred(kind ErrorKind, state State, event Event) {
+	m.errors.add(1, kind, state, event)
+}
+
+func (m *PrometheusMetrics) ObserveAction(state State, event Event, d time.Duration) {
+	m.actionLatency.with(state, event).observe(d.Seconds())
+}
+
+func (m *PrometheusMetrics) ObserveTransitionFunc(from, to State, d time.Duration) {
+	m.transitionFuncLatency.with(from, to).observe(d.Seconds())
+}
+
+func (m *PrometheusMetrics) StateEntered(state State) {
+	m.instances.add(1, state)
+}
+
+func (m *PrometheusMetrics) StateExited(state State) {
+	m.instances.add(-1, state)
+}
+
+// ServeHTTP implements http.Handler interface
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTo write all metrics in Prometheus text exposition format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+
+	m.writeCounters(cw, "events_total", "counter", "Number of events received by FSM.",
+		[]string{"state", "event"}, m.events)
+	m.writeCounters(cw, "errors_total", "counter", "Number of event processing errors.",
+		[]string{"kind", "state", "event"}, m.errors)
+	m.writeCounters(cw, "instances", "gauge", "Number of FSM instances in the state.",
+		[]string{"state"}, m.instances)
+	m.writeHistograms(cw, "action_duration_seconds", "Action function latency.",
+		[]string{"state", "event"}, m.actionLatency)
+	m.writeHistograms(cw, "transition_func_duration_seconds", "Post transition function latency.",
+		[]string{"from", "to"}, m.transitionFuncLatency)
+
+	if cw.err == nil {
+		cw.err = bw.Flush()
+	}
+
+	return cw.n, cw.err
+}
+
+func (m *PrometheusMetrics) name(name string) string {
+	if m.namespace == "" {
+		return name
+	}
+	return m.namespace + "_" + name
+}
+
+func (m *PrometheusMetrics) writeCounters(w io.Writer, name, typ, help string, labels []string, vec *counterVec) {
+	name = m.name(name)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	vec.each(func(values []string, value float64) {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(labels, values), formatFloat(value))
+	})
+}
+
+func (m *PrometheusMetrics) writeHistograms(w io.Writer, name, help string, labels []string, vec *histogramVec) {
+	name = m.name(name)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	vec.each(func(values []string, h *histogram) {
+		cumulative, sum, count := h.snapshot()
+		bucketLabels := append(labels[:len(labels):len(labels)], "le")
+		for i, upper := range h.buckets {
+			bucketValues := append(values[:len(values):len(values)], formatFloat(upper))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabels, bucketValues), cumulative[i])
+		}
+		bucketValues := append(values[:len(values):len(values)], "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(bucketLabels, bucketValues), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(labels, values), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(labels, values), count)
+	})
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabels(names, values []string) string {
+	b := new(strings.Builder)
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		_, _ = labelValueReplacer.WriteString(b, values[i])
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// countingWriter counts written bytes and keeps the first write error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
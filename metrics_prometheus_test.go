@@ -0,0 +1,49 @@
+package go_fsm
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics("fsm")
+	m.EventProcessed("idle", "start")
+	m.ErrorOccurred(ErrorKindActionNotFound, "idle", `st"art`)
+	m.ObserveAction("idle", "start", 2*time.Second)
+	m.StateEntered("idle")
+
+	t.Run("Text exposition", func(t *testing.T) {
+		b := new(strings.Builder)
+		n, err := m.WriteTo(b)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(b.Len()), n)
+
+		out := b.String()
+		assert.Contains(t, out, "# TYPE fsm_events_total counter\n")
+		assert.Contains(t, out, `fsm_events_total{state="idle",event="start"} 1`+"\n")
+		assert.Contains(t, out, `fsm_errors_total{kind="action_not_found",state="idle",event="st\"art"} 1`+"\n")
+		assert.Contains(t, out, "# TYPE fsm_instances gauge\n")
+		assert.Contains(t, out, `fsm_instances{state="idle"} 1`+"\n")
+		assert.Contains(t, out, `fsm_action_duration_seconds_bucket{state="idle",event="start",le="1"} 0`+"\n")
+		assert.Contains(t, out, `fsm_action_duration_seconds_bucket{state="idle",event="start",le="2.5"} 1`+"\n")
+		assert.Contains(t, out, `fsm_action_duration_seconds_bucket{state="idle",event="start",le="+Inf"} 1`+"\n")
+		assert.Contains(t, out, `fsm_action_duration_seconds_sum{state="idle",event="start"} 2`+"\n")
+		assert.Contains(t, out, `fsm_action_duration_seconds_count{state="idle",event="start"} 1`+"\n")
+		assert.Contains(t, out, "# TYPE fsm_transition_func_duration_seconds histogram\n")
+	})
+
+	t.Run("HTTP handler", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		assert.Equal(t, prometheusContentType, rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), `fsm_events_total{state="idle",event="start"} 1`)
+	})
+}
+
+func Test_formatLabels(t *testing.T) {
+	assert.Equal(t, `{a="x",b="y\\z\n"}`, formatLabels([]string{"a", "b"}, []string{"x", "y\\z\n"}))
+}
@@ -0,0 +1,146 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// metrics collector for tests
+type testMetrics struct {
+	mu        sync.Mutex
+	events    []string
+	errors    []ErrorKind
+	actions   int
+	hooks     int
+	instances map[State]int
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{instances: map[State]int{}}
+}
+
+func (m *testMetrics) EventProcessed(state State, event Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, state+":"+event)
+}
+
+func (m *testMetrics) ErrorOccurred(kind ErrorKind, state State, event Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors = append(m.errors, kind)
+}
+
+func (m *testMetrics) ObserveAction(state State, event Event, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.actions++
+}
+
+func (m *testMetrics) ObserveTransitionFunc(from, to State, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks++
+}
+
+func (m *testMetrics) StateEntered(state State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instances[state]++
+}
+
+func (m *testMetrics) StateExited(state State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instances[state]--
+}
+
+func TestFsm_Metrics(t *testing.T) {
+	metrics := newTestMetrics()
+	fsm, err := NewFsm(MetricsOption(metrics)).
+		When("idle", emptyStateActionFunc("next")).
+		When("next", emptyStateActionFunc("unknown")).
+		OnExit("idle", func(from, to State, fsmCtx FsmContext) error {
+			return nil
+		}).
+		OnEnter("next", func(from, to State, fsmCtx FsmContext) error {
+			return nil
+		}).
+		RegisterPreCommitFunc("idle", "next", func(from, to State, fsmCtx FsmContext) error {
+			return nil
+		}).
+		RegisterPostTransitionFunc("*", "*", func(from, to State, fsmCtx FsmContext) error {
+			return nil
+		}).
+		InitWithState("idle")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, metrics.instances["idle"])
+
+	assert.NoError(t, fsm.ProcessEvent("go", nil))
+	assert.Equal(t, 0, metrics.instances["idle"])
+	assert.Equal(t, 1, metrics.instances["next"])
+
+	assert.Error(t, fsm.ProcessEvent("go", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, fsm.ProcessEvent("go", ctx))
+
+	fsm.Close()
+	fsm.Close()
+	assert.Equal(t, 0, metrics.instances["next"])
+
+	assert.Equal(t, []string{"idle:go", "next:go", "next:go"}, metrics.events)
+	assert.Equal(t, []ErrorKind{ErrorKindUnknownNextState, ErrorKindContext}, metrics.errors)
+	assert.Equal(t, 2, metrics.actions)
+	// exit, entry, pre-commit and post-transition functions
+	assert.Equal(t, 4, metrics.hooks)
+}
+
+func Test_errorKindOf(t *testing.T) {
+	assert.Equal(t, ErrorKindActionNotFound, errorKindOf(ErrActionNotFound))
+	assert.Equal(t, ErrorKindUnknownNextState, errorKindOf(ErrUnknownNextState))
+	assert.Equal(t, ErrorKindClosed, errorKindOf(ErrClosed))
+	assert.Equal(t, ErrorKindContext, errorKindOf(context.Canceled))
+	assert.Equal(t, ErrorKindContext, errorKindOf(context.DeadlineExceeded))
+	assert.Equal(t, ErrorKindAction, errorKindOf(errors.New("some error")))
+
+	// wrapped errors
+	assert.Equal(t, ErrorKindContext, errorKindOf(&TransitionError{From: "idle", Event: "start", Cause: context.Canceled}))
+	assert.Equal(t, ErrorKindContext, errorKindOf(fmt.Errorf("call: %w", context.DeadlineExceeded)))
+	assert.Equal(t, ErrorKindActionNotFound, errorKindOf(fmt.Errorf("child: %w", ErrActionNotFound)))
+	assert.Equal(t, ErrorKindPanic, errorKindOf(fmt.Errorf("child: %w", newPanicError("boom", "idle", "start"))))
+}
+
+func Test_histogram(t *testing.T) {
+	h := newHistogram([]float64{1, 2})
+	h.observe(0.5)
+	h.observe(1.5)
+	h.observe(3)
+
+	cumulative, sum, count := h.snapshot()
+	assert.Equal(t, []uint64{1, 2}, cumulative)
+	assert.Equal(t, 5.0, sum)
+	assert.Equal(t, uint64(3), count)
+	assert.Equal(t, `{"count":3,"sum":5,"buckets":{"1":1,"2":2}}`, h.String())
+}
+
+func Test_counterVec(t *testing.T) {
+	v := newCounterVec()
+	v.add(1, "b", "x")
+	v.add(2, "a", "y")
+	v.add(1, "b", "x")
+	assert.Equal(t, 2.0, v.get("b", "x"))
+
+	var order []string
+	v.each(func(values []string, value float64) {
+		order = append(order, values[0])
+	})
+	assert.Equal(t, []string{"a", "b"}, order)
+}
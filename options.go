@@ -3,12 +3,27 @@ package go_fsm
 type Option func(*Options)
 
 type Options struct {
-	Logger Logger
+	// ID of FSM instance, it's added to all log messages (generated if empty)
+	ID               string
+	Logger           Logger
+	StructuredLogger StructuredLogger
+	Metrics          Metrics
+	Tracer           Tracer
+	// size of each subscriber channel buffer
+	SubscriptionBuffer int
+	// definition problems found by Validate reject the first instance instead of being logged
+	StrictValidation bool
+	// store where FSM is saved after each committed transaction and codec of FSM context data (it can be nil)
+	Store     Store
+	DataCodec DataCodec
 }
 
 func newOptions(opts ...Option) Options {
 	opt := Options{
-		Logger: &nilLoggerAdapter{},
+		Logger:             &nilLoggerAdapter{},
+		Metrics:            &nilMetricsAdapter{},
+		Tracer:             NoopTracer{},
+		SubscriptionBuffer: DefaultSubscriptionBuffer,
 	}
 
 	for _, o := range opts {
@@ -18,8 +33,66 @@ func newOptions(opts ...Option) Options {
 	return opt
 }
 
+// structured logger which should be used by FSM, the legacy logger is wrapped by the compatibility adapter
+func (o Options) structuredLogger() StructuredLogger {
+	if o.StructuredLogger != nil {
+		return o.StructuredLogger
+	}
+	if l, ok := o.Logger.(StructuredLogger); ok {
+		return l
+	}
+	return NewLoggerAdapter(o.Logger, LevelDebug)
+}
+
+func IDOption(id string) Option {
+	return func(o *Options) {
+		o.ID = id
+	}
+}
+
 func LoggerOption(l Logger) Option {
 	return func(o *Options) {
 		o.Logger = l
 	}
 }
+
+// StructuredLoggerOption set leveled logger, it takes precedence over LoggerOption
+func StructuredLoggerOption(l StructuredLogger) Option {
+	return func(o *Options) {
+		o.StructuredLogger = l
+	}
+}
+
+func MetricsOption(m Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
+
+func TracerOption(t Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = t
+	}
+}
+
+func SubscriptionBufferOption(size int) Option {
+	return func(o *Options) {
+		o.SubscriptionBuffer = size
+	}
+}
+
+// PersistOption save FSM snapshot to the store after each committed transaction,
+// a failed save rolls the transaction back (see Compensate)
+func PersistOption(store Store, codec DataCodec) Option {
+	return func(o *Options) {
+		o.Store, o.DataCodec = store, codec
+	}
+}
+
+// StrictValidationOption reject instances of a definition which has problems found by Validate
+// (see Definition), by default the problems are logged as a warning when the first instance is created
+func StrictValidationOption() Option {
+	return func(o *Options) {
+		o.StrictValidation = true
+	}
+}
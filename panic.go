@@ -0,0 +1,60 @@
+package go_fsm
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned by ProcessEvent when the action or a post transition function panics,
+// FSM stays in the state it was in before the event
+type PanicError struct {
+	// value passed to panic
+	Value interface{}
+	// stack trace of the panicked goroutine
+	Stack []byte
+	State State
+	Event Event
+}
+
+func newPanicError(value interface{}, state State, event Event) *PanicError {
+	return &PanicError{
+		Value: value,
+		Stack: debug.Stack(),
+		State: state,
+		Event: event,
+	}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in state [%s] on event [%s]: %v", e.State, e.Event, e.Value)
+}
+
+// Unwrap returns the panic value if it's an error
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// call the action function, a panic is converted to PanicError
+func callAction(f ActionFunc, eventCtx EventContext, fsmCtx FsmContext, state State, event Event) (next State, nextFsmCtx FsmContext, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			next, nextFsmCtx, err = "", nil, newPanicError(p, state, event)
+		}
+	}()
+
+	return f(eventCtx, fsmCtx)
+}
+
+// call the pre-commit function, a panic is converted to PanicError
+func callTransitionFunc(fn TransitionFunc, from, to State, fsmCtx FsmContext, event Event) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = newPanicError(p, from, event)
+		}
+	}()
+
+	return fn(from, to, fsmCtx)
+}
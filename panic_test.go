@@ -0,0 +1,78 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// definition which panics on the "panic" event in the action and on the "hookPanic" event in the transition function
+func newPanickingDefinition() *Definition {
+	return NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			switch event, _ := EventFromCtx(eventCtx); event {
+			case "panic":
+				panic("boom")
+			case "hookPanic":
+				return "broken", nil, nil
+			}
+			return "next", context.WithValue(fsmCtx, testCtxKey("data"), "payload"), nil
+		}).
+		When("next", emptyStateActionFunc("idle")).
+		When("broken", emptyStateActionFunc("idle")).
+		RegisterPostTransitionFunc("idle", "broken", func(from, to State, fsmCtx FsmContext) error {
+			panic("hook boom")
+		})
+}
+
+func TestFsm_ActionPanic(t *testing.T) {
+	metrics := newTestMetrics()
+	fsm, err := newPanickingDefinition().NewInstance("idle")
+	assert.NoError(t, err)
+	fsm.def.metrics = metrics
+
+	err = fsm.ProcessEvent("panic", nil)
+	var panicErr *PanicError
+	if assert.True(t, errors.As(err, &panicErr)) {
+		assert.Equal(t, "boom", panicErr.Value)
+		assert.Equal(t, "idle", panicErr.State)
+		assert.Equal(t, "panic", panicErr.Event)
+		assert.Contains(t, string(panicErr.Stack), "newPanickingDefinition")
+	}
+	assert.EqualError(t, err, "panic in state [idle] on event [panic]: boom")
+	assert.Equal(t, []ErrorKind{ErrorKindPanic}, metrics.errors)
+
+	// FSM stays in the previous state and it's still usable
+	assert.Equal(t, "idle", fsm.CurrentState())
+	assert.NoError(t, fsm.ProcessEvent("go", nil))
+	assert.Equal(t, "next", fsm.CurrentState())
+}
+
+func TestFsm_TransitionFuncPanic(t *testing.T) {
+	fsm, err := newPanickingDefinition().NewInstance("idle")
+	assert.NoError(t, err)
+	notifications, cancel := fsm.Subscribe(nil)
+	defer cancel()
+
+	err = fsm.ProcessEvent("hookPanic", nil)
+	var panicErr *PanicError
+	if assert.True(t, errors.As(err, &panicErr)) {
+		assert.Equal(t, "hook boom", panicErr.Value)
+		assert.Equal(t, "idle", panicErr.State)
+		assert.Equal(t, "hookPanic", panicErr.Event)
+		assert.NotEmpty(t, panicErr.Stack)
+	}
+	assert.Equal(t, "idle", fsm.CurrentState())
+	assert.Len(t, notifications, 0)
+
+	assert.NoError(t, fsm.ProcessEvent("go", nil))
+	assert.Equal(t, "next", fsm.CurrentState())
+}
+
+func TestPanicError_Unwrap(t *testing.T) {
+	cause := errors.New("cause")
+	assert.True(t, errors.Is(&PanicError{Value: cause}, cause))
+	assert.Nil(t, (&PanicError{Value: "boom"}).Unwrap())
+}
@@ -0,0 +1,497 @@
+package go_fsm
+
+import (
+	"context"
+	"hash/fnv"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRegistryQueueSize is a default size of each shard events queue
+const DefaultRegistryQueueSize = 64
+
+// Registry manages many FSM instances created from one definition and keyed by entity ID.
+// Instances are spread across a fixed number of shards, each shard is served by a single goroutine,
+// so events for the same ID are processed one by one while events for different IDs run in parallel.
+// Action and transition functions are called on a shard goroutine, they must not wait for the registry calls.
+//
+// If a store is configured, instances which are idle longer than the TTL are snapshotted to the store
+// and evicted from memory, the next event for the ID transparently restores the instance.
+// State timeouts are armed by the registry and they survive passivation.
+type Registry struct {
+	activations  uint64
+	passivations uint64
+
+	def          *Definition
+	initialState State
+	options      registryOptions
+
+	mu     sync.RWMutex
+	closed bool
+	shards []*registryShard
+	// tasks which are being sent to shard queues, queues are closed when all of them are sent
+	senders sync.WaitGroup
+	wg      sync.WaitGroup
+	stop    chan struct{}
+	// closed when all shards are drained
+	done chan struct{}
+}
+
+type RegistryOption func(*registryOptions)
+
+type registryOptions struct {
+	shards    int
+	queueSize int
+	store     Store
+	codec     DataCodec
+	idleTTL   time.Duration
+}
+
+// ShardsOption set number of shard goroutines (runtime.NumCPU by default)
+func ShardsOption(n int) RegistryOption {
+	return func(o *registryOptions) {
+		o.shards = n
+	}
+}
+
+// ShardQueueSizeOption set size of each shard queue
+func ShardQueueSizeOption(size int) RegistryOption {
+	return func(o *registryOptions) {
+		o.queueSize = size
+	}
+}
+
+// StoreOption set store which is used to passivate and restore instances
+func StoreOption(store Store) RegistryOption {
+	return func(o *registryOptions) {
+		o.store = store
+	}
+}
+
+// DataCodecOption set codec of FSM context data which is used in snapshots
+func DataCodecOption(codec DataCodec) RegistryOption {
+	return func(o *registryOptions) {
+		o.codec = codec
+	}
+}
+
+// PassivateAfterOption set TTL of idle instances, it's used only with a store
+func PassivateAfterOption(ttl time.Duration) RegistryOption {
+	return func(o *registryOptions) {
+		o.idleTTL = ttl
+	}
+}
+
+// RegistryStats contains registry counters
+type RegistryStats struct {
+	// number of instances restored from the store
+	Activations uint64
+	// number of instances snapshotted to the store and evicted
+	Passivations uint64
+}
+
+// registryShard owns its instances, maps are accessed only by the shard goroutine
+type registryShard struct {
+	instances  map[string]*Fsm
+	lastActive map[string]time.Time
+	timers     map[string]registryTimer
+	queue      chan func()
+}
+
+// armed state timeout of the instance
+type registryTimer struct {
+	deadline time.Time
+	timer    *time.Timer
+}
+
+// NewRegistry create registry and start shard goroutines,
+// instances are lazily created from the definition with the initial state
+func NewRegistry(def *Definition, initialState State, opts ...RegistryOption) *Registry {
+	options := registryOptions{
+		shards:    runtime.NumCPU(),
+		queueSize: DefaultRegistryQueueSize,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.shards < 1 {
+		options.shards = 1
+	}
+
+	r := &Registry{
+		def:          def,
+		initialState: initialState,
+		options:      options,
+		shards:       make([]*registryShard, options.shards),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	for i := range r.shards {
+		shard := &registryShard{
+			instances:  map[string]*Fsm{},
+			lastActive: map[string]time.Time{},
+			timers:     map[string]registryTimer{},
+			queue:      make(chan func(), options.queueSize),
+		}
+		r.shards[i] = shard
+		r.wg.Add(1)
+		go r.serve(shard)
+	}
+
+	if options.store != nil && options.idleTTL > 0 {
+		go r.passivateLoop()
+	}
+
+	return r
+}
+
+// serve shard queue until it's closed, then passivate or close all shard instances
+func (r *Registry) serve(shard *registryShard) {
+	defer r.wg.Done()
+	for task := range shard.queue {
+		task()
+	}
+
+	for id, t := range shard.timers {
+		t.timer.Stop()
+		delete(shard.timers, id)
+	}
+	for id, fsm := range shard.instances {
+		if r.options.store == nil || !r.passivate(shard, id, fsm) {
+			fsm.CloseWithReason(ReasonShutdown)
+			delete(shard.instances, id)
+		}
+	}
+}
+
+// passivate idle instances periodically
+func (r *Registry) passivateLoop() {
+	interval := r.options.idleTTL / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.PassivateIdle()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *Registry) shardOf(id string) *registryShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return r.shards[h.Sum32()%uint32(len(r.shards))]
+}
+
+// run task on the shard goroutine and wait for the result. If the context is done before the task is started,
+// the task is skipped, but a task which is already running is not interrupted.
+func (r *Registry) run(ctx context.Context, shard *registryShard, task func() error) error {
+	result := make(chan error, 1)
+	err := r.submit(ctx, shard, func() {
+		if err := ctx.Err(); err != nil {
+			result <- err
+			return
+		}
+		result <- task()
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send the task to the shard queue, the lock isn't held while the queue is full,
+// Shutdown closes queues after all started sends are finished
+func (r *Registry) submit(ctx context.Context, shard *registryShard, task func()) error {
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		return ErrRegistryClosed
+	}
+	r.senders.Add(1)
+	r.mu.RUnlock()
+	defer r.senders.Done()
+
+	select {
+	case shard.queue <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// get, restore or lazily create the instance, must be called on the shard goroutine
+func (r *Registry) instance(shard *registryShard, id string) (*Fsm, error) {
+	if fsm, ok := shard.instances[id]; ok {
+		return fsm, nil
+	}
+
+	fsm, err := r.activate(id)
+	if err != nil {
+		return nil, err
+	}
+	shard.instances[id] = fsm
+	shard.lastActive[id] = time.Now()
+	r.armTimer(shard, fsm)
+	return fsm, nil
+}
+
+// restore the instance from the store or create a new one
+func (r *Registry) activate(id string) (*Fsm, error) {
+	if r.options.store != nil {
+		snapshot, err := r.options.store.Load(context.Background(), id)
+		switch err {
+		case nil:
+			fsm, err := r.def.Restore(snapshot, r.options.codec)
+			if err != nil {
+				return nil, err
+			}
+			atomic.AddUint64(&r.activations, 1)
+			return fsm, nil
+		case ErrSnapshotNotFound:
+		default:
+			return nil, err
+		}
+	}
+
+	return r.def.NewInstance(r.initialState, InstanceIDOption(id))
+}
+
+// snapshot the instance to the store and evict it, the instance is kept in memory if it can't be saved
+func (r *Registry) passivate(shard *registryShard, id string, fsm *Fsm) bool {
+	snapshot, err := fsm.Snapshot(r.options.codec)
+	if err == nil {
+		err = r.options.store.Save(context.Background(), snapshot)
+	}
+	if err != nil {
+		fsm.logger.Error("FSM passivation failed", Field{Key: FieldError, Value: err})
+		return false
+	}
+
+	// passivation is not a termination, terminate functions are called when the instance is closed
+	fsm.release(StatusClosed, ReasonPassivated)
+	delete(shard.instances, id)
+	delete(shard.lastActive, id)
+	atomic.AddUint64(&r.passivations, 1)
+	return true
+}
+
+// arm a timer for the instance state timeout, a passivated instance is restored when the timer fires
+func (r *Registry) armTimer(shard *registryShard, fsm *Fsm) {
+	id := fsm.ID()
+	event, deadline, ok := fsm.Timeout()
+	if t, exists := shard.timers[id]; exists {
+		if ok && t.deadline.Equal(deadline) {
+			return
+		}
+		t.timer.Stop()
+		delete(shard.timers, id)
+	}
+	if !ok {
+		return
+	}
+
+	shard.timers[id] = registryTimer{
+		deadline: deadline,
+		timer: time.AfterFunc(time.Until(deadline), func() {
+			_ = r.submit(context.Background(), shard, func() {
+				r.fireTimeout(shard, id, event, deadline)
+			})
+		}),
+	}
+}
+
+// send the timeout event if the timer is still actual
+func (r *Registry) fireTimeout(shard *registryShard, id string, event Event, deadline time.Time) {
+	if t, ok := shard.timers[id]; !ok || !t.deadline.Equal(deadline) {
+		return
+	}
+
+	fsm, err := r.instance(shard, id)
+	if err != nil {
+		r.def.logger.Error("FSM activation failed", Field{Key: FieldFsmID, Value: id}, Field{Key: FieldError, Value: err})
+		return
+	}
+	if _, actual, ok := fsm.Timeout(); !ok || !actual.Equal(deadline) {
+		return
+	}
+
+	_ = fsm.ProcessEvent(event, nil)
+	shard.lastActive[id] = time.Now()
+	r.armTimer(shard, fsm)
+}
+
+// Dispatch route the event to the instance with the ID (the instance is created if needed) and wait for the result.
+// The event context is also used to cancel waiting for a free slot in the shard queue and waiting for the result:
+// an event whose context is done before its processing is started is skipped, but if the context is done while
+// the event is being processed, Dispatch returns the context error and the event is still applied.
+func (r *Registry) Dispatch(id string, event Event, eventCtx EventContext) error {
+	ctx := checkAndFixEmptyContext(eventCtx)
+	shard := r.shardOf(id)
+	return r.run(ctx, shard, func() error {
+		fsm, err := r.instance(shard, id)
+		if err != nil {
+			return err
+		}
+		err = fsm.ProcessEvent(event, ctx)
+		shard.lastActive[id] = time.Now()
+		r.armTimer(shard, fsm)
+		return err
+	})
+}
+
+// Do call the function with exclusive access to the instance which is in memory,
+// the function must not keep the instance after it returns
+func (r *Registry) Do(id string, fn func(fsm *Fsm) error) error {
+	shard := r.shardOf(id)
+	return r.run(context.Background(), shard, func() error {
+		fsm, ok := shard.instances[id]
+		if !ok {
+			return ErrInstanceNotFound
+		}
+		return fn(fsm)
+	})
+}
+
+// Lookup return current state of the instance which is in memory
+func (r *Registry) Lookup(id string) (State, bool) {
+	var state State
+	err := r.Do(id, func(fsm *Fsm) error {
+		state = fsm.CurrentState()
+		return nil
+	})
+	return state, err == nil
+}
+
+// IDs return sorted IDs of all instances which are in memory
+func (r *Registry) IDs() []string {
+	var ids []string
+	for _, shard := range r.shards {
+		shard := shard
+		_ = r.run(context.Background(), shard, func() error {
+			for id := range shard.instances {
+				ids = append(ids, id)
+			}
+			return nil
+		})
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Len return number of instances which are in memory
+func (r *Registry) Len() int {
+	return len(r.IDs())
+}
+
+// Remove close the instance and remove it from the registry and the store,
+// it reports whether the instance was in memory or its snapshot was in the store.
+// The instance is kept if its snapshot can't be deleted from the store.
+func (r *Registry) Remove(id string) (bool, error) {
+	shard := r.shardOf(id)
+	removed := false
+	err := r.run(context.Background(), shard, func() error {
+		if r.options.store != nil {
+			_, err := r.options.store.Load(context.Background(), id)
+			if err != nil && err != ErrSnapshotNotFound {
+				return err
+			}
+			if err := r.options.store.Delete(context.Background(), id); err != nil {
+				return err
+			}
+			removed = err == nil
+		}
+
+		if t, ok := shard.timers[id]; ok {
+			t.timer.Stop()
+			delete(shard.timers, id)
+		}
+		if fsm, ok := shard.instances[id]; ok {
+			fsm.Close()
+			delete(shard.instances, id)
+			delete(shard.lastActive, id)
+			removed = true
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// PassivateIdle snapshot instances which are idle longer than TTL to the store and evict them,
+// it returns number of passivated instances
+func (r *Registry) PassivateIdle() int {
+	if r.options.store == nil {
+		return 0
+	}
+
+	var passivated int
+	for _, shard := range r.shards {
+		shard := shard
+		_ = r.run(context.Background(), shard, func() error {
+			threshold := time.Now().Add(-r.options.idleTTL)
+			for id, fsm := range shard.instances {
+				if !shard.lastActive[id].After(threshold) && r.passivate(shard, id, fsm) {
+					passivated++
+				}
+			}
+			return nil
+		})
+	}
+	return passivated
+}
+
+// Stats return registry counters
+func (r *Registry) Stats() RegistryStats {
+	return RegistryStats{
+		Activations:  atomic.LoadUint64(&r.activations),
+		Passivations: atomic.LoadUint64(&r.passivations),
+	}
+}
+
+// Shutdown stop accepting new events, wait until all queued events are processed and close every instance,
+// instances are snapshotted to the store if it's configured.
+// If the context is done before that, its error is returned and shards keep draining in background.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.stop)
+		go func() {
+			// no new sends are started, queues are closed when the started ones are finished
+			r.senders.Wait()
+			for _, shard := range r.shards {
+				close(shard.queue)
+			}
+			r.wg.Wait()
+			close(r.done)
+		}()
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close is Shutdown without a deadline
+func (r *Registry) Close() {
+	_ = r.Shutdown(context.Background())
+}
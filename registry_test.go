@@ -0,0 +1,404 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistryDefinition() *Definition {
+	return NewDefinition().
+		When("idle", emptyStateActionFunc("next")).
+		When("next", emptyStateActionFunc("idle"))
+}
+
+func TestRegistry_Dispatch(t *testing.T) {
+	r := NewRegistry(newTestRegistryDefinition(), "idle", ShardsOption(4))
+	defer r.Close()
+
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+	assert.NoError(t, r.Dispatch("b", "go", nil))
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+
+	state, ok := r.Lookup("a")
+	assert.True(t, ok)
+	assert.Equal(t, "idle", state)
+	state, ok = r.Lookup("b")
+	assert.True(t, ok)
+	assert.Equal(t, "next", state)
+	_, ok = r.Lookup("c")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"a", "b"}, r.IDs())
+	assert.Equal(t, 2, r.Len())
+
+	assert.NoError(t, r.Do("a", func(fsm *Fsm) error {
+		assert.Equal(t, "a", fsm.ID())
+		return nil
+	}))
+	assert.Equal(t, ErrInstanceNotFound, r.Do("c", func(fsm *Fsm) error {
+		return nil
+	}))
+}
+
+func TestRegistry_InvalidInitialState(t *testing.T) {
+	r := NewRegistry(newTestRegistryDefinition(), "unknown", ShardsOption(1))
+	defer r.Close()
+
+	assert.EqualError(t, r.Dispatch("a", "go", nil), "invalid initial state [unknown]")
+	assert.Equal(t, 0, r.Len())
+}
+
+func TestRegistry_Serialization(t *testing.T) {
+	var inFlight, maxInFlight int32
+	def := NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			return "idle", nil, nil
+		})
+
+	r := NewRegistry(def, "idle", ShardsOption(8))
+	defer r.Close()
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, r.Dispatch("same", "go", context.Background()))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestRegistry_Parallelism(t *testing.T) {
+	r := NewRegistry(newTestRegistryDefinition(), "idle", ShardsOption(4))
+	defer r.Close()
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, r.Dispatch(fmt.Sprint(i), "go", nil))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 100, r.Len())
+}
+
+func TestRegistry_Remove(t *testing.T) {
+	r := NewRegistry(newTestRegistryDefinition(), "idle", ShardsOption(2))
+	defer r.Close()
+
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+	var fsm *Fsm
+	assert.NoError(t, r.Do("a", func(f *Fsm) error {
+		fsm = f
+		return nil
+	}))
+
+	removed, err := r.Remove("a")
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = r.Remove("a")
+	assert.NoError(t, err)
+	assert.False(t, removed)
+	assert.Equal(t, 0, r.Len())
+	assert.Equal(t, context.Canceled, fsm.ctx.Err())
+
+	// a new instance is created for the removed ID
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+	state, _ := r.Lookup("a")
+	assert.Equal(t, "next", state)
+}
+
+func TestRegistry_Shutdown(t *testing.T) {
+	r := NewRegistry(newTestRegistryDefinition(), "idle", ShardsOption(2))
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+
+	var fsm *Fsm
+	assert.NoError(t, r.Do("a", func(f *Fsm) error {
+		fsm = f
+		return nil
+	}))
+
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.NoError(t, r.Shutdown(context.Background()))
+	assert.Equal(t, context.Canceled, fsm.ctx.Err())
+	assert.Equal(t, ErrRegistryClosed, r.Dispatch("a", "go", nil))
+}
+
+func TestRegistry_DispatchContext(t *testing.T) {
+	block := make(chan struct{})
+	def := NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			<-block
+			return "idle", nil, nil
+		})
+	r := NewRegistry(def, "idle", ShardsOption(1), ShardQueueSizeOption(1))
+	defer r.Close()
+	defer close(block)
+
+	go func() {
+		_ = r.Dispatch("a", "go", nil)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, r.Dispatch("a", "go", ctx))
+}
+
+func TestRegistry_DispatchContext_Skipped(t *testing.T) {
+	block := make(chan struct{})
+	var calls int32
+	def := NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-block
+			}
+			return "idle", nil, nil
+		})
+	r := NewRegistry(def, "idle", ShardsOption(1))
+	defer r.Close()
+
+	done := make(chan error)
+	go func() {
+		done <- r.Dispatch("a", "go", nil)
+	}()
+	waitFor(t, func() bool {
+		return atomic.LoadInt32(&calls) == 1
+	})
+
+	// the event is queued, but its context is done before the processing is started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, r.Dispatch("a", "go", ctx))
+	close(block)
+	assert.NoError(t, <-done)
+
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestRegistry_ShutdownWithFullQueue(t *testing.T) {
+	block := make(chan struct{})
+	var calls int32
+	def := NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-block
+			}
+			return "idle", nil, nil
+		})
+	r := NewRegistry(def, "idle", ShardsOption(1), ShardQueueSizeOption(1))
+
+	results := make(chan error, 3)
+	dispatch := func() {
+		results <- r.Dispatch("a", "go", nil)
+	}
+	// the first event is being processed, the second one fills the queue and the third one waits for a free slot
+	go dispatch()
+	waitFor(t, func() bool {
+		return atomic.LoadInt32(&calls) == 1
+	})
+	go dispatch()
+	waitFor(t, func() bool {
+		return len(r.shards[0].queue) == 1
+	})
+	go dispatch()
+	time.Sleep(10 * time.Millisecond)
+
+	// the sender which waits for a free slot doesn't block Shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, r.Shutdown(ctx))
+	assert.Equal(t, ErrRegistryClosed, r.Dispatch("b", "go", nil))
+
+	// events which have been sent before Shutdown are processed
+	close(block)
+	assert.NoError(t, r.Shutdown(context.Background()))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-results)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestRegistry_Passivation(t *testing.T) {
+	store := NewMemoryStore()
+	def := NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			return "next", context.WithValue(fsmCtx, testCtxKey("data"), "payload"), nil
+		}).
+		When("next", emptyStateActionFunc("idle"))
+	r := NewRegistry(def, "idle", ShardsOption(2), StoreOption(store), DataCodecOption(testDataCodec{}))
+
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+	assert.NoError(t, r.Dispatch("b", "go", nil))
+	assert.Equal(t, 2, r.PassivateIdle())
+	assert.Equal(t, 0, r.Len())
+	assert.Equal(t, RegistryStats{Passivations: 2}, r.Stats())
+
+	snapshot, err := store.Load(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "next", snapshot.State)
+	assert.Equal(t, []byte("payload"), snapshot.Data)
+
+	// the instance is restored by the next event
+	assert.Equal(t, ErrInstanceNotFound, r.Do("a", func(fsm *Fsm) error { return nil }))
+	assert.NoError(t, r.Dispatch("a", "back", nil))
+	state, ok := r.Lookup("a")
+	assert.True(t, ok)
+	assert.Equal(t, "idle", state)
+	assert.Equal(t, RegistryStats{Activations: 1, Passivations: 2}, r.Stats())
+
+	// shutdown persists instances which are in memory
+	r.Close()
+	snapshot, err = store.Load(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "idle", snapshot.State)
+}
+
+func TestRegistry_PassivateAfter(t *testing.T) {
+	r := NewRegistry(newTestRegistryDefinition(), "idle",
+		ShardsOption(1),
+		StoreOption(NewMemoryStore()),
+		PassivateAfterOption(5*time.Millisecond),
+	)
+	defer r.Close()
+
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+	waitFor(t, func() bool {
+		return r.Stats().Passivations == 1
+	})
+	assert.Equal(t, 0, r.Len())
+}
+
+func TestRegistry_RemovePassivated(t *testing.T) {
+	store := NewMemoryStore()
+	r := NewRegistry(newTestRegistryDefinition(), "idle", ShardsOption(1), StoreOption(store))
+	defer r.Close()
+
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+	assert.Equal(t, 1, r.PassivateIdle())
+	removed, err := r.Remove("a")
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = r.Remove("a")
+	assert.NoError(t, err)
+	assert.False(t, removed)
+
+	_, err = store.Load(context.Background(), "a")
+	assert.Equal(t, ErrSnapshotNotFound, err)
+}
+
+// store which can't delete snapshots
+type undeletableStore struct {
+	*MemoryStore
+}
+
+func (s *undeletableStore) Delete(ctx context.Context, id string) error {
+	return errors.New("delete failed")
+}
+
+func TestRegistry_RemoveStoreError(t *testing.T) {
+	store := &undeletableStore{MemoryStore: NewMemoryStore()}
+	r := NewRegistry(newTestRegistryDefinition(), "idle", ShardsOption(1), StoreOption(store))
+
+	assert.NoError(t, r.Dispatch("a", "go", nil))
+	removed, err := r.Remove("a")
+	assert.EqualError(t, err, "delete failed")
+	assert.False(t, removed)
+	// the instance is kept, so it can be removed later
+	assert.Equal(t, []string{"a"}, r.IDs())
+
+	r.Close()
+	_, err = r.Remove("a")
+	assert.Equal(t, ErrRegistryClosed, err)
+}
+
+func TestRegistry_StateTimeout(t *testing.T) {
+	def := NewDefinition().
+		When("idle", emptyStateActionFunc("waiting")).
+		When("waiting", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			if event, _ := EventFromCtx(eventCtx); event == "timeout" {
+				return "expired", nil, nil
+			}
+			return "waiting", nil, nil
+		}).
+		When("expired", emptyStateActionFunc("expired")).
+		StateTimeout("waiting", 20*time.Millisecond, "timeout")
+
+	t.Run("Timeout event is dispatched", func(t *testing.T) {
+		r := NewRegistry(def, "idle", ShardsOption(1))
+		defer r.Close()
+
+		assert.NoError(t, r.Dispatch("a", "wait", nil))
+		waitFor(t, func() bool {
+			state, _ := r.Lookup("a")
+			return state == "expired"
+		})
+	})
+
+	t.Run("Timer survives passivation", func(t *testing.T) {
+		store := NewMemoryStore()
+		r := NewRegistry(def, "idle", ShardsOption(1), StoreOption(store))
+		defer r.Close()
+
+		assert.NoError(t, r.Dispatch("a", "wait", nil))
+		assert.Equal(t, 1, r.PassivateIdle())
+
+		waitFor(t, func() bool {
+			state, _ := r.Lookup("a")
+			return state == "expired"
+		})
+		assert.Equal(t, uint64(1), r.Stats().Activations)
+	})
+
+	t.Run("Restored deadline is kept", func(t *testing.T) {
+		store := NewMemoryStore()
+		assert.NoError(t, store.Save(context.Background(), Snapshot{
+			ID:           "a",
+			State:        "waiting",
+			InitialState: "idle",
+			TimeoutEvent: "timeout",
+			Deadline:     time.Now().Add(-time.Second),
+		}))
+		r := NewRegistry(def, "idle", ShardsOption(1), StoreOption(store))
+		defer r.Close()
+
+		// activation arms the timer with the persisted deadline which is already expired
+		assert.NoError(t, r.Dispatch("a", "noop", nil))
+		waitFor(t, func() bool {
+			state, _ := r.Lookup("a")
+			return state == "expired"
+		})
+	})
+}
+
+// wait until the condition is true, testify Eventually is not used because of the race in its implementation
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not satisfied in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,944 @@
+package go_fsm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const scxmlNamespace = "http://www.w3.org/2005/07/scxml"
+
+// reasons of SCXML elements which can't be imported
+var scxmlUnsupported = map[string]string{
+	"history":   "history states are not supported",
+	"datamodel": "data model is not supported",
+	"data":      "data model is not supported",
+	"assign":    "data model is not supported",
+	"invoke":    "invoke is not supported",
+	"donedata":  "done data is not supported",
+}
+
+// element of SCXML document with its position
+type scxmlElement struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*scxmlElement
+	parent   *scxmlElement
+	pos      Position
+	// index in document order
+	index int
+}
+
+func (el *scxmlElement) isState() bool {
+	return el.name == "state" || el.name == "final" || el.name == "parallel"
+}
+
+func (el *scxmlElement) isAtomic() bool {
+	return el.name == "final" || el.name == "state" && len(el.childStates()) == 0
+}
+
+// reports whether the element is a descendant of the ancestor (not the ancestor itself)
+func (el *scxmlElement) isDescendantOf(ancestor *scxmlElement) bool {
+	for parent := el.parent; parent != nil; parent = parent.parent {
+		if parent == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// reports whether the state is in a region of a parallel state
+func (el *scxmlElement) inParallel() bool {
+	for parent := el.parent; parent != nil; parent = parent.parent {
+		if parent.name == "parallel" {
+			return true
+		}
+	}
+	return false
+}
+
+// child states of the compound state
+func (el *scxmlElement) childStates() []*scxmlElement {
+	var states []*scxmlElement
+	for _, child := range el.children {
+		if child.isState() {
+			states = append(states, child)
+		}
+	}
+	return states
+}
+
+// read XML tree, elements of other namespaces are kept with prefixed names and rejected by the importer
+func parseSCXMLTree(data []byte) (*scxmlElement, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root, current *scxmlElement
+	line, lineStart, scanned, count := 1, 0, 0, 0
+	position := func(offset int) Position {
+		for ; scanned < offset && scanned < len(data); scanned++ {
+			if data[scanned] == '\n' {
+				line, lineStart = line+1, scanned+1
+			}
+		}
+		return Position{Line: line, Column: offset - lineStart + 1}
+	}
+
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+			return nil, DocumentErrors{{Line: syntaxErr.Line, Message: syntaxErr.Msg}}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			el := &scxmlElement{name: t.Name.Local, attrs: map[string]string{}, parent: current, pos: position(offset), index: count}
+			count++
+			if t.Name.Space != "" && t.Name.Space != scxmlNamespace {
+				el.name = t.Name.Space + ":" + t.Name.Local
+			}
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns":
+				case attr.Name.Space != "":
+					el.attrs[attr.Name.Space+":"+attr.Name.Local] = attr.Value
+				default:
+					el.attrs[attr.Name.Local] = attr.Value
+				}
+			}
+			if current == nil {
+				if root != nil {
+					return nil, DocumentErrors{{Line: el.pos.Line, Column: el.pos.Column, Message: "multiple root elements"}}
+				}
+				root = el
+			} else {
+				current.children = append(current.children, el)
+			}
+			current = el
+		case xml.EndElement:
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.text += strings.TrimSpace(string(t))
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, DocumentErrors{{Message: "SCXML document is empty"}}
+	}
+	return root, nil
+}
+
+// separator of atomic state IDs in names of product states of parallel states
+const scxmlParallelSeparator = "|"
+
+// configuration of active atomic states in document order, parallel states have an atomic state in each region
+type scxmlConfig []*scxmlElement
+
+// name of the flat state, a product state of parallel regions is named by IDs of its atomic states
+func (c scxmlConfig) name() State {
+	ids := make([]string, len(c))
+	for i, el := range c {
+		ids[i] = el.attrs["id"]
+	}
+	return strings.Join(ids, scxmlParallelSeparator)
+}
+
+// reports whether the element is an ancestor of all states of the configuration or the only state itself
+func (c scxmlConfig) isCommon(el *scxmlElement) bool {
+	for _, state := range c {
+		if state != el && !state.isDescendantOf(el) {
+			return false
+		}
+	}
+	return true
+}
+
+// converts SCXML statechart into a flat document
+type scxmlImporter struct {
+	doc    *Document
+	errs   DocumentErrors
+	states map[string]*scxmlElement
+	// elements which have been checked, elements of compound states are visited for each descendant state
+	checked map[*scxmlElement]bool
+	// <script> elements of <onentry> and <onexit> of states in parallel regions
+	entryScripts map[*scxmlElement][]*scxmlElement
+	exitScripts  map[*scxmlElement][]*scxmlElement
+	// added hooks and reported problems which can be found many times
+	hooks    map[string]bool
+	reported map[string]bool
+}
+
+// ParseSCXML read W3C SCXML document into the declarative model, functions are referenced by names:
+//   - atomic <state> and top level <final> elements become states, compound states are flattened:
+//     their transitions are copied to descendant states and a target compound state is replaced by its initial state;
+//   - <parallel> states are flattened into product states: a state for each combination of atomic states of
+//     the regions named by their IDs joined by "|". Transitions of a region keep states of other regions,
+//     multiple targets and multiple initial states enter states of several regions. An event can be handled
+//     by a single region of the product state;
+//   - <transition event="e" target="s" cond="guard"> becomes a declarative transition, a targetless transition
+//     is an internal self-transition and <script src="name"/> inside the transition is its action;
+//   - <script src="name"/> in <onentry> and <onexit> becomes an entry and exit function of the state (see OnEnter),
+//     for a state of a parallel region it's a pre-commit function of each transition entering or exiting it;
+//   - <send event="e" delay="30s"/> in <onentry> becomes the state timeout (it can be cancelled in <onexit>),
+//     states of parallel regions have no timeouts.
+//
+// Other constructs (history states, data model, eventless transitions, event wildcards, other executable content)
+// are reported by DocumentErrors with line numbers. Events are matched exactly, the cond attribute is a name of
+// the guard rather than an expression.
+func ParseSCXML(data []byte) (*Document, error) {
+	root, err := parseSCXMLTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	imp := &scxmlImporter{
+		doc:          &Document{Position: root.pos},
+		states:       map[string]*scxmlElement{},
+		checked:      map[*scxmlElement]bool{},
+		entryScripts: map[*scxmlElement][]*scxmlElement{},
+		exitScripts:  map[*scxmlElement][]*scxmlElement{},
+		hooks:        map[string]bool{},
+		reported:     map[string]bool{},
+	}
+	imp.importRoot(root)
+	if len(imp.errs) == 0 {
+		imp.errs = imp.doc.validate()
+	}
+	if len(imp.errs) > 0 {
+		return nil, imp.errs
+	}
+	return imp.doc, nil
+}
+
+// LoadSCXML parse SCXML document (see ParseSCXML) and create FSM initialized with its initial state
+func LoadSCXML(data []byte, registry *ActionRegistry, opts ...Option) (*Fsm, error) {
+	doc, err := ParseSCXML(data)
+	if err != nil {
+		return nil, err
+	}
+	def, err := doc.Build(registry, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return def.newFsm(def.options.ID).InitWithState(doc.Initial)
+}
+
+func (imp *scxmlImporter) unsupported(el *scxmlElement) {
+	reason, ok := scxmlUnsupported[el.name]
+	if !ok {
+		reason = "it's not supported"
+		if el.parent != nil {
+			reason = fmt.Sprintf("it's not supported in <%s>", el.parent.name)
+		}
+	}
+	imp.errs.add(el.pos, "unsupported element <%s>: %s", el.name, reason)
+}
+
+// report the problem which can be found on many visits of the element only once
+func (imp *scxmlImporter) reportOnce(pos Position, format string, args ...interface{}) {
+	key := fmt.Sprintf("%d:%d:", pos.Line, pos.Column) + fmt.Sprintf(format, args...)
+	if !imp.reported[key] {
+		imp.reported[key] = true
+		imp.errs.add(pos, format, args...)
+	}
+}
+
+// check that the element has only allowed attributes and no text
+func (imp *scxmlImporter) checkAttrs(el *scxmlElement, allowed ...string) {
+	names := make([]string, 0, len(el.attrs))
+	for name := range el.attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !containsString(allowed, name) {
+			imp.errs.add(el.pos, "unsupported attribute [%s] of <%s>", name, el.name)
+		}
+	}
+	if el.text != "" {
+		imp.errs.add(el.pos, "unsupported text content of <%s>", el.name)
+	}
+}
+
+func (imp *scxmlImporter) importRoot(root *scxmlElement) {
+	if root.name != "scxml" {
+		imp.errs.add(root.pos, "root element must be <scxml>, got <%s>", root.name)
+		return
+	}
+	imp.checkAttrs(root, "initial", "name", "version", "datamodel", "binding")
+	imp.collectStates(root)
+	if initial := imp.enter(root, nil, root.pos); initial != nil {
+		imp.doc.Initial = initial.name()
+		imp.doc.fields = map[string]Position{"initial": root.pos}
+	}
+	for _, config := range imp.configsOf(root) {
+		imp.importConfig(config)
+	}
+}
+
+// register states by ID and report unsupported elements of the state tree
+func (imp *scxmlImporter) collectStates(parent *scxmlElement) {
+	for _, el := range parent.children {
+		switch el.name {
+		case "state", "final", "parallel":
+			id := el.attrs["id"]
+			if id == "" {
+				imp.errs.add(el.pos, "<%s> requires id attribute", el.name)
+				continue
+			}
+			if _, ok := imp.states[id]; ok {
+				imp.errs.add(el.pos, "duplicate state [%s]", id)
+				continue
+			}
+			imp.states[id] = el
+			imp.collectStates(el)
+		case "transition", "onentry", "onexit", "initial":
+			if parent.name == "scxml" || parent.name == "final" && (el.name == "transition" || el.name == "initial") ||
+				parent.name == "parallel" && el.name == "initial" {
+				imp.unsupported(el)
+			}
+		default:
+			imp.unsupported(el)
+		}
+	}
+}
+
+// report problems of the element only once, the returned function drops problems found on later visits
+func (imp *scxmlImporter) once(el *scxmlElement) func() {
+	if !imp.checked[el] {
+		imp.checked[el] = true
+		return func() {}
+	}
+	errs := imp.errs
+	return func() {
+		imp.errs = errs
+	}
+}
+
+// initial states of the root or a compound state, they're descendants of the state
+func (imp *scxmlImporter) initialOf(el *scxmlElement) []*scxmlElement {
+	defer imp.once(el)()
+	ids := strings.Fields(el.attrs["initial"])
+	if len(ids) == 0 {
+		for _, child := range el.children {
+			if child.name != "initial" {
+				continue
+			}
+			imp.checkAttrs(child)
+			for _, t := range child.children {
+				if t.name != "transition" || len(t.children) > 0 {
+					imp.unsupported(t)
+					continue
+				}
+				imp.checkAttrs(t, "target")
+				ids = strings.Fields(t.attrs["target"])
+			}
+		}
+	}
+	if len(ids) == 0 {
+		states := el.childStates()
+		if len(states) == 0 {
+			imp.errs.add(el.pos, "<%s> has no states", el.name)
+			return nil
+		}
+		return states[:1]
+	}
+
+	initial := make([]*scxmlElement, 0, len(ids))
+	for _, id := range ids {
+		state, ok := imp.states[id]
+		if !ok {
+			imp.errs.add(el.pos, "unknown initial state [%s]", id)
+			return nil
+		}
+		if !state.isDescendantOf(el) {
+			imp.errs.add(el.pos, "initial state [%s] is not a descendant of [%s]", id, el.attrs["id"])
+			return nil
+		}
+		initial = append(initial, state)
+	}
+	return initial
+}
+
+// atomic states which are entered with the state: the targets and initial states of other entered states,
+// all regions of an entered parallel state are entered
+func (imp *scxmlImporter) enter(el *scxmlElement, targets []*scxmlElement, pos Position) scxmlConfig {
+	if el.isAtomic() {
+		return scxmlConfig{el}
+	}
+	if el.name == "parallel" {
+		var config scxmlConfig
+		for _, region := range el.childStates() {
+			entered := imp.enter(region, targets, pos)
+			if entered == nil {
+				return nil
+			}
+			config = append(config, entered...)
+		}
+		return config
+	}
+
+	// a child of the compound state which contains the targets
+	var next *scxmlElement
+	for _, child := range el.childStates() {
+		for _, target := range targets {
+			if target != child && !target.isDescendantOf(child) {
+				continue
+			}
+			if next != nil && next != child {
+				imp.errs.add(pos, "states [%s] and [%s] can't be active at once", next.attrs["id"], child.attrs["id"])
+				return nil
+			}
+			next = child
+		}
+	}
+	if next == nil {
+		initial := imp.initialOf(el)
+		if initial == nil {
+			return nil
+		}
+		return imp.enter(el, initial, pos)
+	}
+	return imp.enter(next, targets, pos)
+}
+
+// all configurations of the state in document order, a parallel state has a product of configurations
+// of its regions. Compound and parallel states are checked on the way.
+func (imp *scxmlImporter) configsOf(el *scxmlElement) []scxmlConfig {
+	if el.isAtomic() {
+		return []scxmlConfig{{el}}
+	}
+	imp.checkCompound(el)
+
+	var configs []scxmlConfig
+	if el.name != "parallel" {
+		for _, child := range el.childStates() {
+			configs = append(configs, imp.configsOf(child)...)
+		}
+		return configs
+	}
+
+	for i, region := range el.childStates() {
+		regionConfigs := imp.configsOf(region)
+		if i == 0 {
+			configs = regionConfigs
+			continue
+		}
+		product := make([]scxmlConfig, 0, len(configs)*len(regionConfigs))
+		for _, config := range configs {
+			for _, regionConfig := range regionConfigs {
+				product = append(product, append(append(scxmlConfig{}, config...), regionConfig...))
+			}
+		}
+		configs = product
+	}
+	return configs
+}
+
+// check compound and parallel states, their transitions are copied to descendant states
+func (imp *scxmlImporter) checkCompound(el *scxmlElement) {
+	kind := "compound"
+	switch el.name {
+	case "state":
+		imp.checkAttrs(el, "id", "initial")
+	case "parallel":
+		kind = "parallel"
+		imp.checkAttrs(el, "id")
+		if len(el.childStates()) == 0 {
+			imp.errs.add(el.pos, "<parallel> has no states")
+		}
+	default:
+		return
+	}
+	for _, child := range el.children {
+		if child.name == "onentry" || child.name == "onexit" {
+			imp.errs.add(child.pos, "unsupported element <%s> of %s state [%s]", child.name, kind, el.attrs["id"])
+		}
+	}
+}
+
+// add the flat state of the configuration with transitions
+func (imp *scxmlImporter) importConfig(config scxmlConfig) {
+	if len(config) == 1 && !config[0].inParallel() {
+		imp.importState(config[0])
+		if config[0].name == "final" {
+			return
+		}
+	} else {
+		for _, el := range config {
+			imp.checkRegionState(el)
+		}
+		imp.doc.States = append(imp.doc.States, DocumentState{Name: config.name(), Position: config[0].pos})
+	}
+	imp.addConfigTransitions(config)
+}
+
+func (imp *scxmlImporter) importState(el *scxmlElement) {
+	id := el.attrs["id"]
+	imp.checkAttrs(el, "id")
+	state := DocumentState{Name: id, Position: el.pos}
+	if el.name == "final" {
+		if el.parent.name != "scxml" {
+			imp.errs.add(el.pos, "final state [%s] of compound state is not supported: done events are not supported", id)
+		}
+		state.Final = true
+	}
+
+	// timeout send IDs which can be cancelled on exit
+	timeoutIDs := map[string]bool{}
+	for _, child := range el.children {
+		switch child.name {
+		case "onentry":
+			imp.checkAttrs(child)
+			for _, content := range child.children {
+				switch content.name {
+				case "script":
+					imp.addHook(content, HookEntry, "", id)
+				case "send":
+					imp.checkAttrs(content, "event", "delay", "id")
+					if state.Timeout != nil || content.attrs["delay"] == "" || len(content.children) > 0 {
+						imp.errs.add(content.pos, "unsupported element <send>: only a single delayed event without content is supported as the state timeout")
+						continue
+					}
+					state.Timeout = &DocumentTimeout{After: content.attrs["delay"], Event: content.attrs["event"], Position: content.pos}
+					timeoutIDs[content.attrs["id"]] = content.attrs["id"] != ""
+				default:
+					imp.unsupported(content)
+				}
+			}
+		case "onexit":
+			imp.checkAttrs(child)
+			for _, content := range child.children {
+				switch {
+				case content.name == "script":
+					imp.addHook(content, HookExit, id, "")
+				case content.name == "cancel" && timeoutIDs[content.attrs["sendid"]]:
+					imp.checkAttrs(content, "sendid")
+				default:
+					imp.unsupported(content)
+				}
+			}
+		}
+	}
+	imp.doc.States = append(imp.doc.States, state)
+}
+
+// check the atomic state of a parallel region once and collect scripts of its <onentry> and <onexit>
+func (imp *scxmlImporter) checkRegionState(el *scxmlElement) {
+	if imp.checked[el] {
+		return
+	}
+	imp.checked[el] = true
+
+	id := el.attrs["id"]
+	imp.checkAttrs(el, "id")
+	if el.name == "final" {
+		imp.errs.add(el.pos, "final state [%s] of compound state is not supported: done events are not supported", id)
+	}
+	for _, child := range el.children {
+		scripts := imp.entryScripts
+		switch child.name {
+		case "onentry":
+		case "onexit":
+			scripts = imp.exitScripts
+		default:
+			continue
+		}
+		imp.checkAttrs(child)
+		for _, content := range child.children {
+			switch content.name {
+			case "script":
+				if imp.scriptFunc(content) != "" {
+					scripts[el] = append(scripts[el], content)
+				}
+			case "send":
+				imp.errs.add(content.pos, "unsupported element <send>: state [%s] of parallel state can't have a timeout", id)
+			default:
+				imp.unsupported(content)
+			}
+		}
+	}
+}
+
+// name of the function referenced by <script src="name"/>, it's empty if the element is invalid
+func (imp *scxmlImporter) scriptFunc(el *scxmlElement) string {
+	imp.checkAttrs(el, "src")
+	if el.attrs["src"] == "" {
+		imp.errs.add(el.pos, "<script> requires src attribute with the function name")
+	}
+	return el.attrs["src"]
+}
+
+// add transition function of the kind referenced by <script src="name"/>
+func (imp *scxmlImporter) addHook(el *scxmlElement, kind HookKind, from, to State) {
+	if fn := imp.scriptFunc(el); fn != "" {
+		imp.doc.Hooks = append(imp.doc.Hooks, DocumentHook{Kind: kind, From: from, To: to, Func: fn, Position: el.pos})
+	}
+}
+
+// add pre-commit functions of states of parallel regions which are exited and entered by the transition,
+// product states are entered by transitions of other regions as well, so the functions can't be entry functions
+func (imp *scxmlImporter) addRegionHooks(from, to State, exited, entered scxmlConfig) {
+	for _, hook := range []struct {
+		states  scxmlConfig
+		scripts map[*scxmlElement][]*scxmlElement
+	}{{exited, imp.exitScripts}, {entered, imp.entryScripts}} {
+		for _, state := range hook.states {
+			if !state.inParallel() {
+				continue
+			}
+			imp.checkRegionState(state)
+			for _, script := range hook.scripts[state] {
+				key := from + "\x00" + to + "\x00" + script.attrs["src"]
+				if imp.hooks[key] {
+					continue
+				}
+				imp.hooks[key] = true
+				imp.doc.Hooks = append(imp.doc.Hooks, DocumentHook{Kind: HookPreCommit, From: from, To: to, Func: script.attrs["src"], Position: script.pos})
+			}
+		}
+	}
+}
+
+// add transitions of atomic states of the configuration: transitions of each state and its ancestors
+// within the region first, then transitions of common ancestors, inner states first
+func (imp *scxmlImporter) addConfigTransitions(config scxmlConfig) {
+	var sources []*scxmlElement
+	// atomic states of regions which own the sources, common ancestors have no owner
+	owners := map[*scxmlElement]*scxmlElement{}
+	for _, state := range config {
+		for el := state; !config.isCommon(el); el = el.parent {
+			sources = append(sources, el)
+			owners[el] = state
+		}
+	}
+	for el := config[0]; el.name != "scxml"; el = el.parent {
+		if config.isCommon(el) {
+			sources = append(sources, el)
+		}
+	}
+
+	// regions which handle events, the first allowed transition is taken, so regions can't handle the same event
+	handlers := map[string]*scxmlElement{}
+	for _, source := range sources {
+		for _, child := range source.children {
+			if child.name != "transition" {
+				continue
+			}
+			if owner := owners[source]; owner != nil {
+				for _, event := range strings.Fields(child.attrs["event"]) {
+					if handler, ok := handlers[event]; ok && handler != owner {
+						imp.reportOnce(child.pos, "event [%s] is handled by several regions of parallel state: "+
+							"simultaneous transitions are not supported", event)
+						continue
+					}
+					handlers[event] = owner
+				}
+			}
+			imp.addTransitions(child, config)
+		}
+	}
+}
+
+// add transitions of the <transition> element from the configuration,
+// problems of the element are reported once even if it's copied to many states
+func (imp *scxmlImporter) addTransitions(el *scxmlElement, from scxmlConfig) {
+	defer imp.once(el)()
+
+	imp.checkAttrs(el, "event", "target", "cond", "type")
+	events := strings.Fields(el.attrs["event"])
+	if len(events) == 0 {
+		imp.errs.add(el.pos, "eventless transitions are not supported")
+		return
+	}
+
+	t := DocumentTransition{From: from.name(), Guard: el.attrs["cond"], Position: el.pos}
+	var exited, entered scxmlConfig
+	if targets := strings.Fields(el.attrs["target"]); len(targets) == 0 {
+		t.To, t.Internal = t.From, true
+	} else {
+		var to scxmlConfig
+		if to, exited, entered = imp.transitionTarget(el, from, targets); to == nil {
+			return
+		}
+		t.To = to.name()
+	}
+
+	for _, content := range el.children {
+		if content.name != "script" || t.Action != "" {
+			imp.unsupported(content)
+			continue
+		}
+		imp.checkAttrs(content, "src")
+		t.Action = content.attrs["src"]
+	}
+
+	added := false
+	for _, event := range events {
+		if strings.Contains(event, "*") {
+			imp.errs.add(el.pos, "event wildcard [%s] is not supported", event)
+			continue
+		}
+		t.Event = strings.TrimSuffix(event, ".")
+		imp.doc.Transitions = append(imp.doc.Transitions, t)
+		added = true
+	}
+	if added {
+		imp.addRegionHooks(t.From, t.To, exited, entered)
+	}
+}
+
+// configuration after the transition to the target states and atomic states which are exited and entered:
+// states of the transition domain are exited, the targets (or initial states of compound targets) are entered
+// with initial states of other regions of entered parallel states
+func (imp *scxmlImporter) transitionTarget(el *scxmlElement, from scxmlConfig, ids []string) (to, exited, entered scxmlConfig) {
+	targets := make([]*scxmlElement, 0, len(ids))
+	for _, id := range ids {
+		target, ok := imp.states[id]
+		if !ok {
+			imp.errs.add(el.pos, "unknown target state [%s]", id)
+			return nil, nil, nil
+		}
+		targets = append(targets, target)
+	}
+
+	domain := transitionDomain(el, targets)
+	if entered = imp.enter(domain, targets, el.pos); entered == nil {
+		return nil, nil, nil
+	}
+	for _, state := range from {
+		if state.isDescendantOf(domain) {
+			exited = append(exited, state)
+		} else {
+			to = append(to, state)
+		}
+	}
+	to = append(to, entered...)
+	sort.Slice(to, func(i, j int) bool {
+		return to[i].index < to[j].index
+	})
+	return to, exited, entered
+}
+
+// the state whose descendants are exited and entered by the transition: the source of an internal transition
+// to its descendants or the nearest compound ancestor of the source and the targets
+func transitionDomain(el *scxmlElement, targets []*scxmlElement) *scxmlElement {
+	source := el.parent
+	containsTargets := func(state *scxmlElement) bool {
+		for _, target := range targets {
+			if !target.isDescendantOf(state) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if el.attrs["type"] == "internal" && source.name == "state" && containsTargets(source) {
+		return source
+	}
+	domain := source.parent
+	for domain.name == "parallel" || !containsTargets(domain) {
+		domain = domain.parent
+	}
+	return domain
+}
+
+// WriteSCXML write W3C SCXML representation of the document (see ParseSCXML),
+// constructs which can't be expressed in SCXML are listed in comments
+func (doc *Document) WriteSCXML(w io.Writer) error {
+	return doc.writeSCXML(w, "", nil)
+}
+
+// ExportSCXML write W3C SCXML representation of the declarative model of the definition: states, transitions
+// with named guards, final states and timeouts. Functions have no names in the definition, so actions,
+// unnamed guards, compensations and hooks are listed in comments as well as other constructs SCXML can't express.
+func (def *Definition) ExportSCXML(w io.Writer, opts DiagramOptions) error {
+	s := def.load()
+	doc := &Document{Initial: opts.InitialState}
+	var notes []string
+
+	names := make([]State, 0, len(s.actionMap))
+	for state := range s.actionMap {
+		names = append(names, state)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		state := DocumentState{Name: name, Final: s.finalStates[name]}
+		if s.actionMap[name] != nil {
+			notes = append(notes, fmt.Sprintf("action function of state [%s]", name))
+		}
+		if timeout, ok := s.timeoutMap[name]; ok {
+			state.Timeout = &DocumentTimeout{After: timeout.duration.String(), Event: timeout.event}
+		}
+		doc.States = append(doc.States, state)
+	}
+
+	for _, t := range s.transitions {
+		dt := DocumentTransition{From: t.From, Event: t.Event, To: t.To, Guard: t.GuardName, Internal: t.Internal}
+		if t.Guard != nil && t.GuardName == "" {
+			notes = append(notes, "unnamed guard of "+transitionNote(dt))
+		}
+		if t.Action != nil {
+			notes = append(notes, "action of "+transitionNote(dt))
+		}
+		if t.Compensation != nil {
+			notes = append(notes, "compensation of "+transitionNote(dt))
+		}
+		doc.Transitions = append(doc.Transitions, dt)
+	}
+
+	for _, key := range def.Hooks() {
+		notes = append(notes, fmt.Sprintf("%s functions [%s]", key.Kind, key.states()))
+	}
+
+	events := make([]Event, 0, len(s.anyStateActionMap))
+	for event := range s.anyStateActionMap {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	for _, event := range events {
+		notes = append(notes, fmt.Sprintf("all-state action of event [%s]", event))
+	}
+	if s.unhandledAction != nil {
+		notes = append(notes, "unhandled event action")
+	}
+
+	return doc.writeSCXML(w, opts.Name, notes)
+}
+
+// ExportSCXML write SCXML representation of FSM definition starting from the initial state of FSM
+func (fsm *Fsm) ExportSCXML(w io.Writer, opts DiagramOptions) error {
+	if opts.InitialState == "" {
+		opts.InitialState = fsm.initialState
+	}
+	return fsm.def.ExportSCXML(w, opts)
+}
+
+func transitionNote(t DocumentTransition) string {
+	return fmt.Sprintf("transition [%s -> %s] on event [%s]", t.From, t.To, t.Event)
+}
+
+func (doc *Document) writeSCXML(w io.Writer, name string, notes []string) error {
+	entry, exit := map[State][]string{}, map[State][]string{}
+	for _, h := range doc.Hooks {
+		switch h.Kind {
+		case HookEntry:
+			entry[h.To] = append(entry[h.To], h.Func)
+		case HookExit:
+			exit[h.From] = append(exit[h.From], h.Func)
+		default:
+			notes = append(notes, fmt.Sprintf("%s function [%s] for [%s -> %s]", h.Kind, h.Func, anyState(h.From), anyState(h.To)))
+		}
+	}
+	final := map[State]bool{}
+	for _, s := range doc.States {
+		final[s.Name] = s.Final
+	}
+	transitions := map[State][]DocumentTransition{}
+	for _, t := range doc.Transitions {
+		if final[t.From] {
+			notes = append(notes, "transition of final state: "+transitionNote(t))
+			continue
+		}
+		transitions[t.From] = append(transitions[t.From], t)
+		if t.Compensation != "" {
+			notes = append(notes, fmt.Sprintf("compensation [%s] of %s", t.Compensation, transitionNote(t)))
+		}
+	}
+	for _, s := range doc.States {
+		if s.Action != "" {
+			notes = append(notes, fmt.Sprintf("action function [%s] of state [%s]", s.Action, s.Name))
+		}
+	}
+	for _, a := range doc.Any {
+		notes = append(notes, fmt.Sprintf("all-state action [%s] of event [%s]", a.Action, a.Event))
+	}
+	if doc.Unhandled != "" {
+		notes = append(notes, fmt.Sprintf("unhandled event action [%s]", doc.Unhandled))
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	buf.WriteString("<scxml" + xmlAttr("xmlns", scxmlNamespace) + xmlAttr("version", "1.0"))
+	if doc.Initial != "" {
+		buf.WriteString(xmlAttr("initial", doc.Initial))
+	}
+	if name != "" {
+		buf.WriteString(xmlAttr("name", name))
+	}
+	buf.WriteString(">\n")
+	for _, note := range notes {
+		fmt.Fprintf(buf, "  <!-- not exported: %s -->\n", strings.Replace(note, "--", "- -", -1))
+	}
+
+	for _, s := range doc.States {
+		element := "state"
+		if s.Final {
+			element = "final"
+		}
+		body := new(bytes.Buffer)
+		timeoutID := s.Name + ".timeout"
+		if s.Timeout != nil || len(entry[s.Name]) > 0 {
+			body.WriteString("    <onentry>\n")
+			if s.Timeout != nil {
+				fmt.Fprintf(body, "      <send%s%s%s/>\n", xmlAttr("id", timeoutID), xmlAttr("event", s.Timeout.Event), xmlAttr("delay", s.Timeout.After))
+			}
+			for _, fn := range entry[s.Name] {
+				fmt.Fprintf(body, "      <script%s/>\n", xmlAttr("src", fn))
+			}
+			body.WriteString("    </onentry>\n")
+		}
+		if s.Timeout != nil || len(exit[s.Name]) > 0 {
+			body.WriteString("    <onexit>\n")
+			if s.Timeout != nil {
+				fmt.Fprintf(body, "      <cancel%s/>\n", xmlAttr("sendid", timeoutID))
+			}
+			for _, fn := range exit[s.Name] {
+				fmt.Fprintf(body, "      <script%s/>\n", xmlAttr("src", fn))
+			}
+			body.WriteString("    </onexit>\n")
+		}
+		for _, t := range transitions[s.Name] {
+			body.WriteString("    <transition" + xmlAttr("event", t.Event))
+			if t.Guard != "" {
+				body.WriteString(xmlAttr("cond", t.Guard))
+			}
+			if !t.Internal || t.From != t.To {
+				body.WriteString(xmlAttr("target", t.To))
+			}
+			if t.Action == "" {
+				body.WriteString("/>\n")
+				continue
+			}
+			fmt.Fprintf(body, ">\n      <script%s/>\n    </transition>\n", xmlAttr("src", t.Action))
+		}
+
+		if body.Len() == 0 {
+			fmt.Fprintf(buf, "  <%s%s/>\n", element, xmlAttr("id", s.Name))
+			continue
+		}
+		fmt.Fprintf(buf, "  <%s%s>\n%s  </%s>\n", element, xmlAttr("id", s.Name), body.Bytes(), element)
+	}
+	buf.WriteString("</scxml>\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// XML attribute with escaped value
+func xmlAttr(name, value string) string {
+	buf := new(bytes.Buffer)
+	_ = xml.EscapeText(buf, []byte(value))
+	return fmt.Sprintf(" %s=\"%s\"", name, buf.String())
+}
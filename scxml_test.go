@@ -0,0 +1,315 @@
+package go_fsm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// document without positions which differ between formats
+func withoutPositions(doc *Document) *Document {
+	c := *doc
+	c.Position = Position{}
+	c.States = append([]DocumentState(nil), doc.States...)
+	for i := range c.States {
+		c.States[i].Position = Position{}
+		if t := c.States[i].Timeout; t != nil {
+			c.States[i].Timeout = &DocumentTimeout{After: t.After, Event: t.Event}
+		}
+	}
+	c.Transitions = append([]DocumentTransition(nil), doc.Transitions...)
+	for i := range c.Transitions {
+		c.Transitions[i].Position = Position{}
+	}
+	c.Hooks = append([]DocumentHook(nil), doc.Hooks...)
+	for i := range c.Hooks {
+		c.Hooks[i].Position = Position{}
+	}
+	return &c
+}
+
+func TestParseSCXML(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/statechart.scxml")
+	assert.NoError(t, err)
+
+	doc, err := ParseSCXML(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &Document{
+		Initial: "new",
+		States: []DocumentState{
+			{Name: "new", Timeout: &DocumentTimeout{After: "30m", Event: "expire"}},
+			{Name: "pending"},
+			{Name: "paid"},
+			{Name: "shipped", Final: true},
+			{Name: "cancelled", Final: true},
+		},
+		Transitions: []DocumentTransition{
+			{From: "new", Event: "pay", To: "pending", Guard: "hasFunds", Action: "charge"},
+			{From: "new", Event: "expire", To: "cancelled"},
+			{From: "new", Event: "cancel", To: "cancelled"},
+			{From: "pending", Event: "confirm", To: "paid"},
+			{From: "pending", Event: "retry", To: "paid"},
+			{From: "pending", Event: "note", To: "pending", Internal: true},
+			{From: "pending", Event: "cancel", To: "cancelled"},
+			{From: "paid", Event: "ship", To: "shipped"},
+			{From: "paid", Event: "cancel", To: "cancelled"},
+		},
+		Hooks: []DocumentHook{
+			{Kind: HookEntry, To: "new", Func: "greet"},
+			{Kind: HookExit, From: "paid", Func: "notify"},
+		},
+	}, withoutPositions(doc))
+	assert.Equal(t, 23, doc.Transitions[3].Line)
+
+	var calls []string
+	hook := func(name string) TransitionFunc {
+		return func(from, to State, fsmCtx FsmContext) error {
+			calls = append(calls, name+" "+from+" -> "+to)
+			return nil
+		}
+	}
+	registry := NewActionRegistry().
+		RegisterGuard("hasFunds", func(eventCtx EventContext, fsmCtx FsmContext) bool {
+			return true
+		}).
+		RegisterTransitionAction("charge", setValueAction("charged")).
+		RegisterHook("greet", hook("greet")).
+		RegisterHook("notify", hook("notify"))
+
+	fsm, err := LoadSCXML(data, registry)
+	assert.NoError(t, err)
+	for _, event := range []Event{"pay", "note", "confirm", "cancel"} {
+		assert.NoError(t, fsm.ProcessEvent(event, nil))
+	}
+	assert.Equal(t, "cancelled", fsm.CurrentState())
+	assert.Equal(t, StatusTerminated, fsm.Status())
+	assert.Equal(t, "charged", fsm.ctx.Value(testCtxKey("value")))
+	assert.Equal(t, []string{"notify paid -> cancelled"}, calls)
+}
+
+func TestParseSCXML_Parallel(t *testing.T) {
+	data := []byte(`<scxml xmlns="http://www.w3.org/2005/07/scxml" initial="paused muted">
+  <parallel id="player">
+    <transition event="stop" target="stopped"/>
+    <state id="playback">
+      <state id="paused">
+        <transition event="play" target="playing"/>
+      </state>
+      <state id="playing">
+        <onentry><script src="start"/></onentry>
+        <onexit><script src="halt"/></onexit>
+        <transition event="pause" target="paused"/>
+      </state>
+    </state>
+    <state id="volume">
+      <state id="normal">
+        <transition event="mute" target="muted"/>
+      </state>
+      <state id="muted">
+        <transition event="boost" target="playing normal"/>
+      </state>
+    </state>
+  </parallel>
+  <state id="idle">
+    <transition event="resume" target="player"/>
+  </state>
+  <final id="stopped"/>
+</scxml>`)
+
+	doc, err := ParseSCXML(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &Document{
+		Initial: "paused|muted",
+		States: []DocumentState{
+			{Name: "paused|normal"},
+			{Name: "paused|muted"},
+			{Name: "playing|normal"},
+			{Name: "playing|muted"},
+			{Name: "idle"},
+			{Name: "stopped", Final: true},
+		},
+		Transitions: []DocumentTransition{
+			{From: "paused|normal", Event: "play", To: "playing|normal"},
+			{From: "paused|normal", Event: "mute", To: "paused|muted"},
+			{From: "paused|normal", Event: "stop", To: "stopped"},
+			{From: "paused|muted", Event: "play", To: "playing|muted"},
+			{From: "paused|muted", Event: "boost", To: "playing|normal"},
+			{From: "paused|muted", Event: "stop", To: "stopped"},
+			{From: "playing|normal", Event: "pause", To: "paused|normal"},
+			{From: "playing|normal", Event: "mute", To: "playing|muted"},
+			{From: "playing|normal", Event: "stop", To: "stopped"},
+			{From: "playing|muted", Event: "pause", To: "paused|muted"},
+			{From: "playing|muted", Event: "boost", To: "playing|normal"},
+			{From: "playing|muted", Event: "stop", To: "stopped"},
+			{From: "idle", Event: "resume", To: "paused|normal"},
+		},
+		Hooks: []DocumentHook{
+			{Kind: HookPreCommit, From: "paused|normal", To: "playing|normal", Func: "start"},
+			{Kind: HookPreCommit, From: "paused|muted", To: "playing|muted", Func: "start"},
+			{Kind: HookPreCommit, From: "paused|muted", To: "playing|normal", Func: "start"},
+			{Kind: HookPreCommit, From: "playing|normal", To: "paused|normal", Func: "halt"},
+			{Kind: HookPreCommit, From: "playing|normal", To: "stopped", Func: "halt"},
+			{Kind: HookPreCommit, From: "playing|muted", To: "paused|muted", Func: "halt"},
+			{Kind: HookPreCommit, From: "playing|muted", To: "playing|normal", Func: "halt"},
+			{Kind: HookPreCommit, From: "playing|muted", To: "playing|normal", Func: "start"},
+			{Kind: HookPreCommit, From: "playing|muted", To: "stopped", Func: "halt"},
+		},
+	}, withoutPositions(doc))
+
+	// scripts of exited states are called before scripts of entered states
+	var calls []string
+	hook := func(name string) TransitionFunc {
+		return func(from, to State, fsmCtx FsmContext) error {
+			calls = append(calls, name+" "+from+" -> "+to)
+			return nil
+		}
+	}
+	registry := NewActionRegistry().RegisterHook("start", hook("start")).RegisterHook("halt", hook("halt"))
+
+	fsm, err := LoadSCXML(data, registry)
+	assert.NoError(t, err)
+	for _, event := range []Event{"play", "boost", "mute", "stop"} {
+		assert.NoError(t, fsm.ProcessEvent(event, nil))
+	}
+	assert.Equal(t, "stopped", fsm.CurrentState())
+	assert.Equal(t, []string{
+		"start paused|muted -> playing|muted",
+		"halt playing|muted -> playing|normal",
+		"start playing|muted -> playing|normal",
+		"halt playing|muted -> stopped",
+	}, calls)
+}
+
+func TestParseSCXML_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		scxml  string
+		errors string
+	}{
+		{
+			name: "Unsupported",
+			scxml: `<scxml xmlns="http://www.w3.org/2005/07/scxml" initial="a">
+  <datamodel><data id="x"/></datamodel>
+  <parallel id="p">
+    <state id="p1"/>
+  </parallel>
+  <state id="a">
+    <onentry><raise event="go"/></onentry>
+    <transition target="b"/>
+    <transition event="error.*" target="b"/>
+    <transition event="go" target="a b"/>
+    <history id="h"/>
+  </state>
+  <state id="b" src="b.scxml"/>
+</scxml>`,
+			errors: "line 2: unsupported element <datamodel>: data model is not supported; " +
+				"line 11: unsupported element <history>: history states are not supported; " +
+				"line 7: unsupported element <raise>: it's not supported in <onentry>; " +
+				"line 8: eventless transitions are not supported; " +
+				"line 9: event wildcard [error.*] is not supported; " +
+				"line 10: states [a] and [b] can't be active at once; " +
+				"line 13: unsupported attribute [src] of <state>",
+		},
+		{
+			name: "Compound states",
+			scxml: `<scxml xmlns="http://www.w3.org/2005/07/scxml">
+  <state id="a">
+    <onentry><script src="enter"/></onentry>
+    <transition event="go" target="c" cond="ok">
+      <log expr="'go'"/>
+    </transition>
+    <state id="a1"/>
+    <state id="a2"/>
+    <final id="a3"/>
+  </state>
+</scxml>`,
+			errors: "line 3: unsupported element <onentry> of compound state [a]; " +
+				"line 4: unknown target state [c]; " +
+				"line 9: final state [a3] of compound state is not supported: done events are not supported",
+		},
+		{
+			name: "Parallel states",
+			scxml: `<scxml xmlns="http://www.w3.org/2005/07/scxml">
+  <parallel id="p">
+    <onentry><script src="enter"/></onentry>
+    <state id="a">
+      <onentry><send event="expire" delay="1s"/></onentry>
+      <transition event="reset" target="a"/>
+    </state>
+    <state id="b">
+      <transition event="reset" target="b"/>
+    </state>
+  </parallel>
+  <parallel id="q"/>
+</scxml>`,
+			errors: "line 3: unsupported element <onentry> of parallel state [p]; " +
+				"line 12: <parallel> has no states; " +
+				"line 5: unsupported element <send>: state [a] of parallel state can't have a timeout; " +
+				"line 9: event [reset] is handled by several regions of parallel state: simultaneous transitions are not supported",
+		},
+		{
+			name:   "Initial state",
+			scxml:  `<scxml xmlns="http://www.w3.org/2005/07/scxml" initial="x"><state id="a"/></scxml>`,
+			errors: "line 1: unknown initial state [x]",
+		},
+		{
+			name:   "Syntax",
+			scxml:  "<scxml>\n<state id=\"a\">\n</scxml>",
+			errors: "line 3: element <state> closed by </scxml>",
+		},
+		{
+			name:   "Root",
+			scxml:  `<statechart/>`,
+			errors: "line 1: root element must be <scxml>, got <statechart>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc, err := ParseSCXML([]byte(test.scxml))
+			assert.Nil(t, doc)
+			assert.EqualError(t, err, test.errors)
+
+			var errs DocumentErrors
+			assert.True(t, errors.As(err, &errs))
+		})
+	}
+}
+
+func TestDefinition_ExportSCXML(t *testing.T) {
+	def := newDiagramDefinition().
+		StateTimeout("order.payment.pending", time.Minute, "expire").
+		WhenAny("ping", emptyStateActionFunc("order.new"))
+
+	assertGolden(t, "order.scxml", func(w io.Writer) error {
+		return def.ExportSCXML(w, DiagramOptions{Name: "order", InitialState: "order.new"})
+	})
+	assert.EqualError(t, def.ExportSCXML(failingWriter{}, DiagramOptions{}), "write error")
+}
+
+func TestDocument_WriteSCXML(t *testing.T) {
+	doc, err := ParseDocument([]byte(orderDocument))
+	assert.NoError(t, err)
+	assertGolden(t, "document.scxml", doc.WriteSCXML)
+
+	// constructs which SCXML can express survive the round trip
+	buf := new(bytes.Buffer)
+	assert.NoError(t, doc.WriteSCXML(buf))
+	imported, err := ParseSCXML(buf.Bytes())
+	if !assert.NoError(t, err) {
+		return
+	}
+	expected := withoutPositions(doc)
+	expected.Any, expected.Hooks = nil, expected.Hooks[:2]
+	expected.Transitions[0].Compensation, expected.States[2].Action = "", ""
+	assert.Equal(t, expected, withoutPositions(imported))
+}
@@ -0,0 +1,196 @@
+package go_fsm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// syntax of a state diagram format, Mermaid and PlantUML diagrams differ only in details
+type stateDiagramSyntax struct {
+	// indent of top level statements and nested states
+	bodyIndent string
+	indent     string
+	header     func(d *diagram) string
+	footer     func(d *diagram) string
+	// declaration of a simple state
+	state func(id, label string, opaque bool) string
+	// quoted label of a state
+	quote func(label string) string
+	// escaped text of transitions and notes
+	escape func(text string) string
+	// arrow of transitions to declared targets of action functions
+	actionArrow string
+}
+
+// Mermaid doesn't support backslash escapes, special characters are written as entity codes
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;", "#", "#35;", ";", "#59;", "\n", " ", "\r", " ")
+
+func mermaidQuote(label string) string {
+	return `"` + mermaidEscaper.Replace(label) + `"`
+}
+
+var mermaidSyntax = stateDiagramSyntax{
+	bodyIndent: "    ",
+	indent:     "    ",
+	header: func(d *diagram) string {
+		header := fmt.Sprintf("---\ntitle: %s\n---\nstateDiagram-v2\n", d.name)
+		for _, state := range d.states {
+			if state.opaque {
+				return header + "    classDef opaque stroke-dasharray: 5 5\n"
+			}
+		}
+		return header
+	},
+	footer: func(d *diagram) string {
+		var footer string
+		for _, name := range sortedStates(d) {
+			if d.states[name].opaque {
+				footer += fmt.Sprintf("    class %s opaque\n", d.ids[name])
+			}
+		}
+		return footer
+	},
+	state: func(id, label string, opaque bool) string {
+		return fmt.Sprintf("state %s as %s", mermaidQuote(label), id)
+	},
+	quote:       mermaidQuote,
+	escape:      mermaidEscaper.Replace,
+	actionArrow: "-->",
+}
+
+// PlantUML doesn't support escapes in quoted strings, special characters are written as Unicode code points,
+// backslashes would start escape sequences of labels and a colon would split a transition label
+var plantUMLEscaper = strings.NewReplacer(`"`, "<U+0022>", `\`, "<U+005C>", ":", "<U+003A>", "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func plantUMLQuote(label string) string {
+	return `"` + plantUMLEscaper.Replace(label) + `"`
+}
+
+var plantUMLSyntax = stateDiagramSyntax{
+	indent: "  ",
+	header: func(d *diagram) string {
+		return fmt.Sprintf("@startuml\ntitle %s\nhide empty description\n", d.name)
+	},
+	footer: func(d *diagram) string {
+		return "@enduml\n"
+	},
+	state: func(id, label string, opaque bool) string {
+		line := fmt.Sprintf("state %s as %s", plantUMLQuote(label), id)
+		if opaque {
+			line += " ##[dashed]"
+		}
+		return line
+	},
+	quote:       plantUMLQuote,
+	escape:      plantUMLEscaper.Replace,
+	actionArrow: "-[dashed]->",
+}
+
+// ExportMermaid write Mermaid stateDiagram-v2 representation of the definition,
+// hierarchical states are nested and guards are shown in notes
+func (def *Definition) ExportMermaid(w io.Writer, opts DiagramOptions) error {
+	return def.diagram(opts).writeStateDiagram(w, mermaidSyntax)
+}
+
+// ExportPlantUML write PlantUML state diagram representation of the definition,
+// hierarchical states are nested and guards are shown in notes
+func (def *Definition) ExportPlantUML(w io.Writer, opts DiagramOptions) error {
+	return def.diagram(opts).writeStateDiagram(w, plantUMLSyntax)
+}
+
+// ExportMermaid write Mermaid state diagram of FSM definition starting from the initial state of FSM
+func (fsm *Fsm) ExportMermaid(w io.Writer, opts DiagramOptions) error {
+	if opts.InitialState == "" {
+		opts.InitialState = fsm.initialState
+	}
+	return fsm.def.ExportMermaid(w, opts)
+}
+
+// ExportPlantUML write PlantUML state diagram of FSM definition starting from the initial state of FSM
+func (fsm *Fsm) ExportPlantUML(w io.Writer, opts DiagramOptions) error {
+	if opts.InitialState == "" {
+		opts.InitialState = fsm.initialState
+	}
+	return fsm.def.ExportPlantUML(w, opts)
+}
+
+func (d *diagram) writeStateDiagram(w io.Writer, syntax stateDiagramSyntax) error {
+	buf := new(bytes.Buffer)
+	buf.WriteString(syntax.header(d))
+	d.writeStateDiagramCluster(buf, syntax, d.root, syntax.bodyIndent)
+
+	if d.initial != "" {
+		fmt.Fprintf(buf, "%s[*] --> %s\n", syntax.bodyIndent, d.id(d.initial))
+	}
+	for _, t := range d.transitions {
+		arrow := "-->"
+		if t.action {
+			arrow = syntax.actionArrow
+		}
+		line := fmt.Sprintf("%s%s %s %s", syntax.bodyIndent, d.id(t.From), arrow, d.id(t.To))
+		if label := t.eventLabel(); label != "" {
+			line += " : " + syntax.escape(label)
+		}
+		buf.WriteString(line + "\n")
+	}
+	for _, name := range sortedStates(d) {
+		if d.states[name].final {
+			fmt.Fprintf(buf, "%s%s --> [*]\n", syntax.bodyIndent, d.ids[name])
+		}
+	}
+	buf.WriteString(syntax.footer(d))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (d *diagram) writeStateDiagramCluster(buf *bytes.Buffer, syntax stateDiagramSyntax, cluster *diagramCluster, indent string) {
+	for _, name := range cluster.states {
+		// the state is rendered as a composite state
+		if _, ok := d.clusters[name]; ok {
+			continue
+		}
+		state := d.states[name]
+		fmt.Fprintf(buf, "%s%s\n", indent, syntax.state(d.ids[name], state.label, state.opaque))
+		d.writeGuardNotes(buf, syntax, name, indent)
+	}
+
+	for _, child := range cluster.children {
+		fmt.Fprintf(buf, "%sstate %s as %s {\n", indent, syntax.quote(child.label), d.ids[child.name])
+		d.writeStateDiagramCluster(buf, syntax, child, indent+syntax.indent)
+		fmt.Fprintf(buf, "%s}\n", indent)
+		d.writeGuardNotes(buf, syntax, child.name, indent)
+	}
+}
+
+func (d *diagram) writeGuardNotes(buf *bytes.Buffer, syntax stateDiagramSyntax, state State, indent string) {
+	notes := d.guardNotes(state)
+	if len(notes) == 0 {
+		return
+	}
+	fmt.Fprintf(buf, "%snote right of %s\n", indent, d.ids[state])
+	for _, note := range notes {
+		fmt.Fprintf(buf, "%s%s%s\n", indent, syntax.indent, syntax.escape(note))
+	}
+	fmt.Fprintf(buf, "%send note\n", indent)
+}
+
+// identifier of the state, unregistered states get an identifier as well
+func (d *diagram) id(state State) string {
+	if id, ok := d.ids[state]; ok {
+		return id
+	}
+	return diagramID(state)
+}
+
+func sortedStates(d *diagram) []State {
+	names := make([]State, 0, len(d.states))
+	for name := range d.states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
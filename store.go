@@ -0,0 +1,125 @@
+package go_fsm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Snapshot is a persistent representation of FSM instance
+type Snapshot struct {
+	ID           string
+	State        State
+	InitialState State
+	// FSM context data encoded by DataCodec (empty if codec is not used)
+	Data []byte
+	// pending state timeout, zero deadline means no timeout
+	TimeoutEvent Event
+	Deadline     time.Time
+}
+
+// Store keeps FSM snapshots
+type Store interface {
+	Save(ctx context.Context, snapshot Snapshot) error
+	// Load returns ErrSnapshotNotFound if there is no snapshot for the ID
+	Load(ctx context.Context, id string) (Snapshot, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// DataCodec converts FSM context values to bytes and back,
+// only values known by the codec survive a snapshot
+type DataCodec interface {
+	Marshal(fsmCtx FsmContext) ([]byte, error)
+	// Unmarshal returns a copy of the parent context which carries decoded values
+	Unmarshal(parent context.Context, data []byte) (FsmContext, error)
+}
+
+//Snapshot return a persistent representation of FSM, context data is encoded by the codec (it can be nil)
+func (fsm *Fsm) Snapshot(codec DataCodec) (Snapshot, error) {
+	snapshot := Snapshot{
+		ID:           fsm.id,
+		State:        fsm.state,
+		InitialState: fsm.initialState,
+		TimeoutEvent: fsm.timeoutEvent,
+		Deadline:     fsm.deadline,
+	}
+
+	if codec != nil {
+		data, err := codec.Marshal(fsm.ctx)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		snapshot.Data = data
+	}
+
+	return snapshot, nil
+}
+
+//Restore create FSM instance from the snapshot, context data is decoded by the codec (it can be nil),
+//FSM restored in a final state is terminated
+func (def *Definition) Restore(snapshot Snapshot, codec DataCodec) (*Fsm, error) {
+	if err := def.validateInitialState(snapshot.State); err != nil {
+		return nil, err
+	}
+	if err := def.freeze(); err != nil {
+		return nil, err
+	}
+
+	var parent context.Context = context.Background()
+	if codec != nil && len(snapshot.Data) > 0 {
+		ctx, err := codec.Unmarshal(parent, snapshot.Data)
+		if err != nil {
+			return nil, err
+		}
+		parent = ctx
+	}
+
+	fsm := def.newFsm(snapshot.ID)
+	fsm.initialState = snapshot.InitialState
+	fsm.parent = context.Background()
+	fsm.start(parent, snapshot.State)
+	// keep the persisted deadline instead of the one armed on start
+	fsm.timeoutEvent, fsm.deadline = snapshot.TimeoutEvent, snapshot.Deadline
+	fsm.logger.Info("FSM restored", Field{Key: FieldState, Value: snapshot.State})
+	// the instance has terminated before the snapshot was taken, so terminate functions aren't called again
+	if def.load().finalStates[snapshot.State] {
+		fsm.release(StatusTerminated, ReasonFinalState)
+	}
+
+	return fsm, nil
+}
+
+// MemoryStore is an in-memory Store implementation
+type MemoryStore struct {
+	mu        sync.RWMutex
+	snapshots map[string]Snapshot
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{snapshots: map[string]Snapshot{}}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot.Data = append([]byte(nil), snapshot.Data...)
+	s.snapshots[snapshot.ID] = snapshot
+	return nil
+}
+
+func (s *MemoryStore) Load(ctx context.Context, id string) (Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot, ok := s.snapshots[id]
+	if !ok {
+		return Snapshot{}, ErrSnapshotNotFound
+	}
+	return snapshot, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.snapshots, id)
+	return nil
+}
@@ -0,0 +1,132 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCtxKey string
+
+// codec which keeps a single string value of the "data" key
+type testDataCodec struct {
+}
+
+func (testDataCodec) Marshal(fsmCtx FsmContext) ([]byte, error) {
+	value, _ := fsmCtx.Value(testCtxKey("data")).(string)
+	return []byte(value), nil
+}
+
+func (testDataCodec) Unmarshal(parent context.Context, data []byte) (FsmContext, error) {
+	if string(data) == "invalid" {
+		return nil, errors.New("invalid data")
+	}
+	return context.WithValue(parent, testCtxKey("data"), string(data)), nil
+}
+
+func TestFsm_Snapshot(t *testing.T) {
+	def := NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			return "next", context.WithValue(fsmCtx, testCtxKey("data"), "payload"), nil
+		}).
+		When("next", emptyStateActionFunc("idle")).
+		StateTimeout("next", time.Hour, "expired")
+
+	fsm, err := def.NewInstance("idle", InstanceIDOption("order-1"))
+	assert.NoError(t, err)
+	assert.NoError(t, fsm.ProcessEvent("go", nil))
+
+	snapshot, err := fsm.Snapshot(testDataCodec{})
+	assert.NoError(t, err)
+	assert.Equal(t, "order-1", snapshot.ID)
+	assert.Equal(t, "next", snapshot.State)
+	assert.Equal(t, "idle", snapshot.InitialState)
+	assert.Equal(t, []byte("payload"), snapshot.Data)
+	assert.Equal(t, "expired", snapshot.TimeoutEvent)
+	assert.False(t, snapshot.Deadline.IsZero())
+
+	t.Run("Restore", func(t *testing.T) {
+		restored, err := def.Restore(snapshot, testDataCodec{})
+		assert.NoError(t, err)
+		assert.Equal(t, "order-1", restored.ID())
+		assert.Equal(t, "next", restored.CurrentState())
+		assert.Equal(t, "payload", restored.ctx.Value(testCtxKey("data")))
+		event, deadline, ok := restored.Timeout()
+		assert.True(t, ok)
+		assert.Equal(t, "expired", event)
+		assert.Equal(t, snapshot.Deadline, deadline)
+
+		assert.NoError(t, restored.Reset())
+		assert.Equal(t, "idle", restored.CurrentState())
+	})
+
+	t.Run("Restore without codec", func(t *testing.T) {
+		restored, err := def.Restore(snapshot, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, restored.ctx.Value(testCtxKey("data")))
+	})
+
+	t.Run("Restore errors", func(t *testing.T) {
+		_, err := def.Restore(Snapshot{ID: "a", State: "unknown"}, nil)
+		assert.EqualError(t, err, "invalid initial state [unknown]")
+
+		_, err = def.Restore(Snapshot{ID: "a", State: "idle", Data: []byte("invalid")}, testDataCodec{})
+		assert.EqualError(t, err, "invalid data")
+	})
+}
+
+func TestDefinition_Restore_FinalState(t *testing.T) {
+	terminated := 0
+	def := NewDefinition().
+		When("idle", emptyStateActionFunc("done")).
+		Final("done").
+		OnTerminate(func(reason TerminateReason, state State, fsmCtx FsmContext) {
+			terminated++
+		})
+
+	fsm, err := def.NewInstance("idle", InstanceIDOption("order-1"))
+	assert.NoError(t, err)
+	assert.NoError(t, fsm.ProcessEvent("go", nil))
+	assert.Equal(t, 1, terminated)
+
+	snapshot, err := fsm.Snapshot(nil)
+	assert.NoError(t, err)
+
+	restored, err := def.Restore(snapshot, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "done", restored.CurrentState())
+	assert.Equal(t, StatusTerminated, restored.Status())
+	assert.Equal(t, ReasonFinalState, restored.Reason())
+	assert.True(t, errors.Is(restored.ProcessEvent("go", nil), ErrTerminated))
+	select {
+	case <-restored.Done():
+	default:
+		t.Fatal("done channel of the restored FSM isn't closed")
+	}
+	// terminate functions were called by the original instance
+	assert.Equal(t, 1, terminated)
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	_, err := store.Load(ctx, "a")
+	assert.Equal(t, ErrSnapshotNotFound, err)
+
+	data := []byte("data")
+	assert.NoError(t, store.Save(ctx, Snapshot{ID: "a", State: "idle", Data: data}))
+	data[0] = 'x'
+
+	snapshot, err := store.Load(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "idle", snapshot.State)
+	assert.Equal(t, []byte("data"), snapshot.Data)
+
+	assert.NoError(t, store.Delete(ctx, "a"))
+	_, err = store.Load(ctx, "a")
+	assert.Equal(t, ErrSnapshotNotFound, err)
+}
@@ -0,0 +1,122 @@
+package go_fsm
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultSubscriptionBuffer is a default size of subscriber channel buffer
+const DefaultSubscriptionBuffer = 16
+
+// TransitionNotification describes a committed FSM transition
+type TransitionNotification struct {
+	FsmID string
+	From  State
+	To    State
+	Event Event
+	Time  time.Time
+	// Internal is true for an internal self-transition which changes FSM context only
+	Internal bool
+	// Dropped is the number of notifications which were dropped for this subscriber
+	// since the previous delivered one because its buffer was full
+	Dropped uint64
+}
+
+// SubscriptionFilter reports whether the notification should be delivered to the subscriber, nil filter accepts all
+type SubscriptionFilter = func(n TransitionNotification) bool
+
+type subscription struct {
+	ch      chan TransitionNotification
+	filter  SubscriptionFilter
+	dropped uint64
+}
+
+// subscribers is a set of transition observers, delivery never blocks the publisher
+type subscribers struct {
+	mu      sync.Mutex
+	size    int
+	lastID  uint64
+	subs    map[uint64]*subscription
+	closed  bool
+	dropped uint64
+}
+
+func newSubscribers(size int) *subscribers {
+	if size < 1 {
+		size = 1
+	}
+
+	return &subscribers{size: size}
+}
+
+// add subscriber, a closed channel is returned if subscribers have been closed
+func (s *subscribers) subscribe(filter SubscriptionFilter) (<-chan TransitionNotification, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan TransitionNotification, s.size)
+	if s.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if s.subs == nil {
+		s.subs = map[uint64]*subscription{}
+	}
+	s.lastID++
+	id := s.lastID
+	s.subs[id] = &subscription{ch: ch, filter: filter}
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if sub, ok := s.subs[id]; ok {
+			delete(s.subs, id)
+			close(sub.ch)
+		}
+	}
+}
+
+func (s *subscribers) publish(n TransitionNotification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.subs {
+		if sub.filter != nil && !sub.filter(n) {
+			continue
+		}
+
+		n.Dropped = sub.dropped
+		select {
+		case sub.ch <- n:
+			sub.dropped = 0
+		default:
+			sub.dropped++
+			s.dropped++
+		}
+	}
+}
+
+// close all subscriber channels, new subscribers receive a closed channel until reopen is called
+func (s *subscribers) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, sub := range s.subs {
+		delete(s.subs, id)
+		close(sub.ch)
+	}
+	s.closed = true
+}
+
+func (s *subscribers) reopen() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = false
+}
+
+func (s *subscribers) droppedCount() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
@@ -0,0 +1,97 @@
+package go_fsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsm_Subscribe(t *testing.T) {
+	newFsm := func(opts ...Option) *Fsm {
+		fsm, err := NewFsm(append(opts, IDOption("test"))...).
+			When("idle", emptyStateActionFunc("next")).
+			When("next", emptyStateActionFunc("idle")).
+			InitWithState("idle")
+		assert.NoError(t, err)
+		return fsm
+	}
+
+	t.Run("Notifications", func(t *testing.T) {
+		fsm := newFsm()
+		ch, cancel := fsm.Subscribe(nil)
+		defer cancel()
+
+		assert.NoError(t, fsm.ProcessEvent("go", nil))
+		n := <-ch
+		assert.Equal(t, "test", n.FsmID)
+		assert.Equal(t, "idle", n.From)
+		assert.Equal(t, "next", n.To)
+		assert.Equal(t, "go", n.Event)
+		assert.False(t, n.Time.IsZero())
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		fsm := newFsm()
+		ch, cancel := fsm.Subscribe(func(n TransitionNotification) bool {
+			return n.To == "idle"
+		})
+		defer cancel()
+
+		assert.NoError(t, fsm.ProcessEvent("go", nil))
+		assert.NoError(t, fsm.ProcessEvent("back", nil))
+		assert.Equal(t, "back", (<-ch).Event)
+		assert.Len(t, ch, 0)
+	})
+
+	t.Run("Drop when buffer is full", func(t *testing.T) {
+		fsm := newFsm(SubscriptionBufferOption(1))
+		ch, cancel := fsm.Subscribe(nil)
+		defer cancel()
+
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, fsm.ProcessEvent("go", nil))
+		}
+		assert.Equal(t, uint64(2), fsm.DroppedNotifications())
+
+		n := <-ch
+		assert.Equal(t, uint64(0), n.Dropped)
+		assert.NoError(t, fsm.ProcessEvent("go", nil))
+		n = <-ch
+		assert.Equal(t, uint64(2), n.Dropped)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		fsm := newFsm()
+		ch, cancel := fsm.Subscribe(nil)
+		cancel()
+		cancel()
+
+		_, ok := <-ch
+		assert.False(t, ok)
+		assert.NoError(t, fsm.ProcessEvent("go", nil))
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		fsm := newFsm()
+		ch, cancel := fsm.Subscribe(nil)
+		fsm.Close()
+		cancel()
+
+		_, ok := <-ch
+		assert.False(t, ok)
+
+		ch, _ = fsm.Subscribe(nil)
+		_, ok = <-ch
+		assert.False(t, ok)
+	})
+
+	t.Run("Reset keeps subscriptions", func(t *testing.T) {
+		fsm := newFsm()
+		ch, cancel := fsm.Subscribe(nil)
+		defer cancel()
+
+		assert.NoError(t, fsm.Reset())
+		assert.NoError(t, fsm.ProcessEvent("go", nil))
+		assert.Equal(t, "next", (<-ch).To)
+	})
+}
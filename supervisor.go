@@ -0,0 +1,317 @@
+package go_fsm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RestartStrategy defines which children are restarted when one of them panics
+type RestartStrategy int
+
+const (
+	// OneForOne restarts only the child which panicked
+	OneForOne RestartStrategy = iota
+	// OneForAll restarts all children
+	OneForAll
+)
+
+// ChildSpec describes a supervised FSM
+type ChildSpec struct {
+	ID           string
+	Definition   *Definition
+	InitialState State
+	// RestoreSnapshot restarts the child from the snapshot taken after the last successfully processed event
+	// instead of the initial state, FSM context data is encoded by the codec (it can be nil)
+	RestoreSnapshot bool
+	Codec           DataCodec
+}
+
+// Supervisor restarts FSM instances which panic inside an action or a post transition function,
+// it's designed with alignment to Erlang supervisors. If there are more than the allowed number
+// of restarts within the time window, the supervisor stops all children and escalates the failure.
+// Events of each child are processed one by one, different children process events in parallel.
+type Supervisor struct {
+	mu       sync.Mutex
+	options  supervisorOptions
+	children map[string]*supervisedChild
+	restarts []time.Time
+	stopped  bool
+}
+
+// the child lock serializes events of the child, the supervisor lock is always acquired first
+type supervisedChild struct {
+	mu       sync.Mutex
+	spec     ChildSpec
+	fsm      *Fsm
+	snapshot *Snapshot
+}
+
+type SupervisorOption func(*supervisorOptions)
+
+type supervisorOptions struct {
+	strategy    RestartStrategy
+	maxRestarts int
+	window      time.Duration
+	escalate    func(err error)
+}
+
+// StrategyOption set restart strategy (OneForOne by default)
+func StrategyOption(strategy RestartStrategy) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.strategy = strategy
+	}
+}
+
+// RestartIntensityOption allow at most maxRestarts restarts within the window (3 restarts in 5 seconds by default)
+func RestartIntensityOption(maxRestarts int, window time.Duration) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.maxRestarts, o.window = maxRestarts, window
+	}
+}
+
+// EscalateOption set the function which is called when restart intensity is exceeded
+func EscalateOption(fn func(err error)) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.escalate = fn
+	}
+}
+
+func NewSupervisor(opts ...SupervisorOption) *Supervisor {
+	options := supervisorOptions{
+		strategy:    OneForOne,
+		maxRestarts: 3,
+		window:      5 * time.Second,
+		escalate:    func(err error) {},
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &Supervisor{
+		options:  options,
+		children: map[string]*supervisedChild{},
+	}
+}
+
+// StartChild create FSM described by the spec and put it under supervision, it returns the current instance
+// of the child for inspection only. Events must be sent via ProcessEvent: the instance driven directly
+// bypasses event serialization and snapshots of the supervisor, and it's replaced by a restart.
+func (s *Supervisor) StartChild(spec ChildSpec) (*Fsm, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return nil, ErrSupervisorStopped
+	}
+	if _, ok := s.children[spec.ID]; ok {
+		return nil, fmt.Errorf("child [%s] already exists", spec.ID)
+	}
+
+	child := &supervisedChild{spec: spec}
+	if err := s.start(child); err != nil {
+		return nil, err
+	}
+	s.children[spec.ID] = child
+
+	return child.fsm, nil
+}
+
+// start (or restart) the child from its last snapshot or initial state
+func (s *Supervisor) start(child *supervisedChild) error {
+	var fsm *Fsm
+	var err error
+	if child.spec.RestoreSnapshot && child.snapshot != nil {
+		fsm, err = child.spec.Definition.Restore(*child.snapshot, child.spec.Codec)
+	} else {
+		fsm, err = child.spec.Definition.NewInstance(child.spec.InitialState, InstanceIDOption(child.spec.ID))
+	}
+	if err != nil {
+		return err
+	}
+
+	child.fsm = fsm
+	return nil
+}
+
+// ProcessEvent process the event by the child, the child is restarted if it panics (see PanicError)
+func (s *Supervisor) ProcessEvent(id string, event Event, eventCtx EventContext) error {
+	child, err := s.child(id)
+	if err != nil {
+		return err
+	}
+
+	fsm, err := child.processEvent(event, eventCtx)
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return s.restart(child, fsm, panicErr)
+	}
+	return err
+}
+
+// look up the child, the supervisor lock isn't held while the child processes events
+func (s *Supervisor) child(id string) (*supervisedChild, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return nil, ErrSupervisorStopped
+	}
+	child, ok := s.children[id]
+	if !ok {
+		return nil, ErrInstanceNotFound
+	}
+	return child, nil
+}
+
+// process the event by the current instance of the child and return the instance
+func (c *supervisedChild) processEvent(event Event, eventCtx EventContext) (*Fsm, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.fsm.ProcessEvent(event, eventCtx)
+	if err == nil && c.spec.RestoreSnapshot {
+		snapshot, err := c.fsm.Snapshot(c.spec.Codec)
+		if err != nil {
+			return c.fsm, err
+		}
+		c.snapshot = &snapshot
+	}
+	return c.fsm, err
+}
+
+// restart children according to the strategy or escalate if restart intensity is exceeded,
+// the escalate function is called without the supervisor lock, so it can use the supervisor
+func (s *Supervisor) restart(failed *supervisedChild, fsm *Fsm, cause *PanicError) error {
+	err := s.restartChildren(failed, fsm, cause)
+	if escalation, ok := err.(*EscalationError); ok {
+		s.options.escalate(escalation)
+	}
+	return err
+}
+
+// nothing is restarted if the failed instance has already been restarted by a concurrent event,
+// the supervisor is stopped and EscalationError is returned if restart intensity is exceeded
+func (s *Supervisor) restartChildren(failed *supervisedChild, fsm *Fsm, cause *PanicError) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return ErrSupervisorStopped
+	}
+	failed.mu.Lock()
+	restarted := failed.fsm != fsm
+	failed.mu.Unlock()
+	if restarted {
+		return &RestartError{ChildID: failed.spec.ID, Cause: cause}
+	}
+
+	now := time.Now()
+	restarts := s.restarts[:0]
+	for _, at := range s.restarts {
+		if now.Sub(at) < s.options.window {
+			restarts = append(restarts, at)
+		}
+	}
+	s.restarts = append(restarts, now)
+
+	if len(s.restarts) > s.options.maxRestarts {
+		s.stop()
+		return &EscalationError{Restarts: len(s.restarts), Window: s.options.window, Cause: cause}
+	}
+
+	children := []*supervisedChild{failed}
+	if s.options.strategy == OneForAll {
+		children = s.sortedChildren()
+	}
+	for _, child := range children {
+		child.mu.Lock()
+		child.fsm.CloseWithReason(ReasonRestart)
+		err := s.start(child)
+		child.mu.Unlock()
+		if err != nil {
+			s.stop()
+			return &EscalationError{Restarts: len(s.restarts), Window: s.options.window, Cause: err}
+		}
+	}
+
+	return &RestartError{ChildID: failed.spec.ID, Cause: cause}
+}
+
+func (s *Supervisor) sortedChildren() []*supervisedChild {
+	ids := make([]string, 0, len(s.children))
+	for id := range s.children {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	children := make([]*supervisedChild, len(ids))
+	for i, id := range ids {
+		children[i] = s.children[id]
+	}
+	return children
+}
+
+// Child return the current instance of the child for inspection, it changes after a restart,
+// so the returned instance goes stale. Don't process events by the instance directly (see StartChild)
+func (s *Supervisor) Child(id string) (*Fsm, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	child, ok := s.children[id]
+	if !ok {
+		return nil, false
+	}
+	// the instance is replaced under both locks
+	return child.fsm, true
+}
+
+// Stop close all children, the supervisor can't be used after that
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+}
+
+func (s *Supervisor) stop() {
+	if s.stopped {
+		return
+	}
+	for _, child := range s.sortedChildren() {
+		child.mu.Lock()
+		child.fsm.CloseWithReason(ReasonShutdown)
+		child.mu.Unlock()
+	}
+	s.stopped = true
+}
+
+// RestartError is returned by Supervisor.ProcessEvent when the child has been restarted
+type RestartError struct {
+	ChildID string
+	Cause   *PanicError
+}
+
+func (e *RestartError) Error() string {
+	return fmt.Sprintf("child [%s] restarted: %s", e.ChildID, e.Cause)
+}
+
+func (e *RestartError) Unwrap() error {
+	return e.Cause
+}
+
+// EscalationError is returned when the supervisor exceeds restart intensity and stops
+type EscalationError struct {
+	Restarts int
+	Window   time.Duration
+	Cause    error
+}
+
+func (e *EscalationError) Error() string {
+	return fmt.Sprintf("restart intensity exceeded (%d restarts in %s): %s", e.Restarts, e.Window, e.Cause)
+}
+
+func (e *EscalationError) Unwrap() error {
+	return e.Cause
+}
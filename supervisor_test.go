@@ -0,0 +1,147 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupervisor_OneForOne(t *testing.T) {
+	def := newPanickingDefinition()
+	s := NewSupervisor()
+	defer s.Stop()
+
+	a, err := s.StartChild(ChildSpec{ID: "a", Definition: def, InitialState: "idle"})
+	assert.NoError(t, err)
+	b, err := s.StartChild(ChildSpec{ID: "b", Definition: def, InitialState: "idle"})
+	assert.NoError(t, err)
+	_, err = s.StartChild(ChildSpec{ID: "a", Definition: def, InitialState: "idle"})
+	assert.EqualError(t, err, "child [a] already exists")
+
+	assert.NoError(t, s.ProcessEvent("b", "go", nil))
+
+	err = s.ProcessEvent("a", "panic", nil)
+	var restartErr *RestartError
+	if assert.True(t, errors.As(err, &restartErr)) {
+		assert.Equal(t, "a", restartErr.ChildID)
+		assert.Equal(t, "boom", restartErr.Cause.Value)
+	}
+	assert.EqualError(t, err, "child [a] restarted: panic in state [idle] on event [panic]: boom")
+
+	restarted, ok := s.Child("a")
+	assert.True(t, ok)
+	assert.NotEqual(t, a, restarted)
+	assert.Equal(t, "idle", restarted.CurrentState())
+
+	current, _ := s.Child("b")
+	assert.Equal(t, b, current)
+	assert.Equal(t, "next", current.CurrentState())
+
+	// hook panic is supervised as well
+	assert.Error(t, s.ProcessEvent("a", "hookPanic", nil))
+	assert.Equal(t, ErrInstanceNotFound, s.ProcessEvent("c", "go", nil))
+}
+
+func TestSupervisor_OneForAll(t *testing.T) {
+	def := newPanickingDefinition()
+	s := NewSupervisor(StrategyOption(OneForAll))
+	defer s.Stop()
+
+	_, err := s.StartChild(ChildSpec{ID: "a", Definition: def, InitialState: "idle"})
+	assert.NoError(t, err)
+	b, err := s.StartChild(ChildSpec{ID: "b", Definition: def, InitialState: "idle"})
+	assert.NoError(t, err)
+	assert.NoError(t, s.ProcessEvent("b", "go", nil))
+
+	assert.Error(t, s.ProcessEvent("a", "panic", nil))
+	current, _ := s.Child("b")
+	assert.NotEqual(t, b, current)
+	assert.Equal(t, "idle", current.CurrentState())
+}
+
+func TestSupervisor_RestoreSnapshot(t *testing.T) {
+	s := NewSupervisor()
+	defer s.Stop()
+
+	def := newPanickingDefinition().
+		When("next", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			panic("boom")
+		})
+	_, err := s.StartChild(ChildSpec{ID: "a", Definition: def, InitialState: "idle", RestoreSnapshot: true, Codec: testDataCodec{}})
+	assert.NoError(t, err)
+	assert.NoError(t, s.ProcessEvent("a", "go", nil))
+
+	assert.Error(t, s.ProcessEvent("a", "panic", nil))
+	fsm, _ := s.Child("a")
+	assert.Equal(t, "next", fsm.CurrentState())
+	assert.Equal(t, "payload", fsm.ctx.Value(testCtxKey("data")))
+}
+
+func TestSupervisor_Escalation(t *testing.T) {
+	var escalated error
+	var s *Supervisor
+	s = NewSupervisor(
+		RestartIntensityOption(1, time.Minute),
+		EscalateOption(func(err error) {
+			escalated = err
+			// the supervisor isn't locked while the failure is escalated
+			s.Stop()
+		}),
+	)
+
+	a, err := s.StartChild(ChildSpec{ID: "a", Definition: newPanickingDefinition(), InitialState: "idle"})
+	assert.NoError(t, err)
+
+	assert.Error(t, s.ProcessEvent("a", "panic", nil))
+	restarted, _ := s.Child("a")
+	assert.NotEqual(t, a, restarted)
+
+	err = s.ProcessEvent("a", "panic", nil)
+	var escalation *EscalationError
+	if assert.True(t, errors.As(err, &escalation)) {
+		assert.Equal(t, 2, escalation.Restarts)
+		assert.Equal(t, time.Minute, escalation.Window)
+	}
+	assert.Equal(t, err, escalated)
+	assert.Equal(t, context.Canceled, restarted.ctx.Err())
+
+	assert.Equal(t, ErrSupervisorStopped, s.ProcessEvent("a", "go", nil))
+	_, err = s.StartChild(ChildSpec{ID: "b", Definition: newPanickingDefinition(), InitialState: "idle"})
+	assert.Equal(t, ErrSupervisorStopped, err)
+}
+
+func TestSupervisor_ParallelChildren(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := NewDefinition().
+		When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+			close(started)
+			<-release
+			return "idle", nil, nil
+		})
+	s := NewSupervisor()
+	defer s.Stop()
+
+	_, err := s.StartChild(ChildSpec{ID: "slow", Definition: slow, InitialState: "idle"})
+	assert.NoError(t, err)
+	_, err = s.StartChild(ChildSpec{ID: "fast", Definition: newPanickingDefinition(), InitialState: "idle"})
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- s.ProcessEvent("slow", "go", nil)
+	}()
+	<-started
+
+	// the slow child doesn't block other children, their restarts and lookups
+	var restartErr *RestartError
+	assert.True(t, errors.As(s.ProcessEvent("fast", "panic", nil), &restartErr))
+	assert.NoError(t, s.ProcessEvent("fast", "go", nil))
+	_, ok := s.Child("slow")
+	assert.True(t, ok)
+
+	close(release)
+	assert.NoError(t, <-done)
+}
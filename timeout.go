@@ -0,0 +1,43 @@
+package go_fsm
+
+import "time"
+
+// state timeout configuration, the event is sent to an instance which stays in the state longer than the duration
+type stateTimeout struct {
+	duration time.Duration
+	event    Event
+}
+
+//StateTimeout send the event to an instance which stays in the state longer than the duration.
+//Timeouts are armed by Registry, a standalone FSM only tracks the deadline (see Fsm.Timeout).
+func (def *Definition) StateTimeout(state State, d time.Duration, event Event) *Definition {
+	def.update("StateTimeout", func(s *definitionSnapshot) {
+		s.timeoutMap[state] = stateTimeout{duration: d, event: event}
+	})
+	return def
+}
+
+//StateTimeout set timeout of the state in FSM definition (see Definition.StateTimeout). FSM only records
+//the deadline when it enters the state (see Fsm.Timeout), the event is delivered only if FSM is managed by Registry.
+func (fsm *Fsm) StateTimeout(state State, d time.Duration, event Event) *Fsm {
+	fsm.def.StateTimeout(state, d, event)
+	return fsm
+}
+
+//Timeout return the pending timeout event and its deadline
+func (fsm Fsm) Timeout() (event Event, deadline time.Time, ok bool) {
+	if fsm.deadline.IsZero() {
+		return "", time.Time{}, false
+	}
+	return fsm.timeoutEvent, fsm.deadline, true
+}
+
+// arm timeout of the current state or disarm it if the state has no timeout
+func (fsm *Fsm) armTimeout(def *definitionSnapshot) {
+	timeout, ok := def.timeoutMap[fsm.state]
+	if !ok {
+		fsm.timeoutEvent, fsm.deadline = "", time.Time{}
+		return
+	}
+	fsm.timeoutEvent, fsm.deadline = timeout.event, time.Now().Add(timeout.duration)
+}
@@ -0,0 +1,31 @@
+package go_fsm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsm_StateTimeout(t *testing.T) {
+	fsm, err := NewFsm().
+		When("idle", emptyStateActionFunc("waiting")).
+		When("waiting", emptyStateActionFunc("idle")).
+		StateTimeout("waiting", time.Minute, "expired").
+		InitWithState("idle")
+	assert.NoError(t, err)
+
+	_, _, ok := fsm.Timeout()
+	assert.False(t, ok)
+
+	startedAt := time.Now()
+	assert.NoError(t, fsm.ProcessEvent("wait", nil))
+	event, deadline, ok := fsm.Timeout()
+	assert.True(t, ok)
+	assert.Equal(t, "expired", event)
+	assert.WithinDuration(t, startedAt.Add(time.Minute), deadline, time.Second)
+
+	assert.NoError(t, fsm.ProcessEvent("expired", nil))
+	_, _, ok = fsm.Timeout()
+	assert.False(t, ok)
+}
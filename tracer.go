@@ -0,0 +1,209 @@
+package go_fsm
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// span names
+const (
+	SpanProcessEvent   = "fsm.ProcessEvent"
+	SpanAction         = "fsm.action"
+	SpanTransitionFunc = "fsm.transition_func"
+)
+
+// span attribute keys
+const (
+	AttrState     = "fsm.state"
+	AttrEvent     = "fsm.event"
+	AttrNextState = "fsm.next_state"
+	AttrError     = "fsm.error"
+)
+
+// Attribute is a key/value pair attached to a span
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Tracer is a generic tracing interface which is used by FSM to open spans around event processing.
+// It is small enough to be adapted to any tracing library (e.g. OpenTelemetry).
+type Tracer interface {
+	// Start creates a span as a child of the span stored in ctx (if any)
+	// and returns a copy of ctx which carries the new span
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+	// ContextWithSpan returns a copy of ctx which carries the span
+	ContextWithSpan(ctx context.Context, span Span) context.Context
+}
+
+// Span is a single traced operation
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// record error (if any) and finish the span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(Attribute{Key: AttrError, Value: err.Error()})
+	}
+	span.End()
+}
+
+// NoopTracer is a tracer which records nothing
+type NoopTracer struct {
+}
+
+func (NoopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (NoopTracer) ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return ctx
+}
+
+type noopSpan struct {
+}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {
+}
+
+func (noopSpan) RecordError(err error) {
+}
+
+func (noopSpan) End() {
+}
+
+type ctxSpanKey int
+
+var spanCtxKey ctxSpanKey
+
+// RecordingTracer is an in-memory tracer which keeps all started spans, it is useful in tests
+type RecordingTracer struct {
+	mu     sync.Mutex
+	lastID uint64
+	spans  []*RecordedSpan
+}
+
+func NewRecordingTracer() *RecordingTracer {
+	return &RecordingTracer{}
+}
+
+// RecordedSpan is a span created by RecordingTracer
+type RecordedSpan struct {
+	mu sync.Mutex
+
+	ID        uint64
+	ParentID  uint64
+	Name      string
+	StartTime time.Time
+
+	attrs   []Attribute
+	err     error
+	ended   bool
+	endTime time.Time
+}
+
+func (t *RecordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &RecordedSpan{
+		ID:        atomic.AddUint64(&t.lastID, 1),
+		Name:      name,
+		StartTime: time.Now(),
+		attrs:     append([]Attribute(nil), attrs...),
+	}
+	if parent, ok := ctx.Value(spanCtxKey).(*RecordedSpan); ok {
+		span.ParentID = parent.ID
+	}
+
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+
+	return t.ContextWithSpan(ctx, span), span
+}
+
+func (t *RecordingTracer) ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanCtxKey, span)
+}
+
+// Spans returns all started spans in the start order
+func (t *RecordingTracer) Spans() []*RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*RecordedSpan(nil), t.spans...)
+}
+
+// Reset removes all recorded spans
+func (t *RecordingTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+// RecordedSpanFromCtx returns the recorded span stored in ctx
+func RecordedSpanFromCtx(ctx context.Context) (*RecordedSpan, bool) {
+	span, ok := ctx.Value(spanCtxKey).(*RecordedSpan)
+	return span, ok
+}
+
+func (s *RecordedSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+func (s *RecordedSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *RecordedSpan) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endTime, s.ended = time.Now(), true
+}
+
+// Attribute returns the last value set for the key
+func (s *RecordedSpan) Attribute(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.attrs) - 1; i >= 0; i-- {
+		if s.attrs[i].Key == key {
+			return s.attrs[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Attributes returns all span attributes in the order they were set
+func (s *RecordedSpan) Attributes() []Attribute {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Attribute(nil), s.attrs...)
+}
+
+// Err returns the recorded error
+func (s *RecordedSpan) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Ended reports whether End has been called
+func (s *RecordedSpan) Ended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ended
+}
+
+// EndTime returns the time when End has been called
+func (s *RecordedSpan) EndTime() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endTime
+}
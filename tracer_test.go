@@ -0,0 +1,125 @@
+package go_fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsm_Tracer(t *testing.T) {
+	t.Run("Spans hierarchy and attributes", func(t *testing.T) {
+		tracer := NewRecordingTracer()
+		var hookSpan *RecordedSpan
+		fsm, err := NewFsm(TracerOption(tracer)).
+			When("idle", emptyStateActionFunc("next")).
+			When("next", emptyStateActionFunc("idle")).
+			RegisterPostTransitionFunc("idle", "next", func(from, to State, fsmCtx FsmContext) error {
+				hookSpan, _ = RecordedSpanFromCtx(fsmCtx)
+				return errors.New("hook error")
+			}).
+			InitWithState("idle")
+		assert.NoError(t, err)
+
+		parentCtx, parent := tracer.Start(context.Background(), "request")
+		assert.NoError(t, fsm.ProcessEvent("go", parentCtx))
+		parent.End()
+
+		spans := tracer.Spans()
+		if assert.Len(t, spans, 4) {
+			event, action, hook := spans[1], spans[2], spans[3]
+			assert.Equal(t, SpanProcessEvent, event.Name)
+			assert.Equal(t, spans[0].ID, event.ParentID)
+			assert.Equal(t, SpanAction, action.Name)
+			assert.Equal(t, event.ID, action.ParentID)
+			assert.Equal(t, SpanTransitionFunc, hook.Name)
+			assert.Equal(t, event.ID, hook.ParentID)
+			assert.Equal(t, hook, hookSpan)
+
+			for _, span := range spans {
+				assert.True(t, span.Ended())
+			}
+
+			state, _ := event.Attribute(AttrState)
+			assert.Equal(t, "idle", state)
+			eventName, _ := event.Attribute(AttrEvent)
+			assert.Equal(t, "go", eventName)
+			next, _ := event.Attribute(AttrNextState)
+			assert.Equal(t, "next", next)
+			assert.NoError(t, event.Err())
+
+			hookErr, _ := hook.Attribute(AttrError)
+			assert.Equal(t, "hook error", hookErr)
+			assert.EqualError(t, hook.Err(), "hook error")
+		}
+	})
+
+	t.Run("Exit, entry and pre-commit functions", func(t *testing.T) {
+		tracer := NewRecordingTracer()
+		hookSpans := map[string]*RecordedSpan{}
+		hook := func(name string, err error) TransitionFunc {
+			return func(from, to State, fsmCtx FsmContext) error {
+				hookSpans[name], _ = RecordedSpanFromCtx(fsmCtx)
+				return err
+			}
+		}
+		fsm, err := NewFsm(TracerOption(tracer)).
+			When("idle", emptyStateActionFunc("next")).
+			When("next", emptyStateActionFunc("idle")).
+			OnExit("idle", hook("exit", nil)).
+			OnEnter("next", hook("entry", nil)).
+			RegisterPreCommitFunc("idle", "next", hook("pre-commit", errors.New("rejected"))).
+			InitWithState("idle")
+		assert.NoError(t, err)
+
+		assert.Error(t, fsm.ProcessEvent("go", nil))
+		spans := tracer.Spans()
+		if assert.Len(t, spans, 5) {
+			event, exit, entry, preCommit := spans[0], spans[2], spans[3], spans[4]
+			assert.Equal(t, SpanProcessEvent, event.Name)
+			for name, span := range map[string]*RecordedSpan{"exit": exit, "entry": entry, "pre-commit": preCommit} {
+				assert.Equal(t, SpanTransitionFunc, span.Name, name)
+				assert.Equal(t, event.ID, span.ParentID, name)
+				assert.Equal(t, span, hookSpans[name], name)
+				assert.True(t, span.Ended(), name)
+
+				state, _ := span.Attribute(AttrState)
+				assert.Equal(t, "idle", state, name)
+				next, _ := span.Attribute(AttrNextState)
+				assert.Equal(t, "next", next, name)
+			}
+			assert.NoError(t, exit.Err())
+			assert.NoError(t, entry.Err())
+			assert.EqualError(t, preCommit.Err(), "rejected")
+		}
+	})
+
+	t.Run("Failed event", func(t *testing.T) {
+		tracer := NewRecordingTracer()
+		fsm, err := NewFsm(TracerOption(tracer)).
+			When("idle", emptyStateActionFunc("unknown")).
+			InitWithState("idle")
+		assert.NoError(t, err)
+
+		assert.Error(t, fsm.ProcessEvent("go", nil))
+		spans := tracer.Spans()
+		if assert.Len(t, spans, 2) {
+			assert.True(t, errors.Is(spans[0].Err(), ErrUnknownNextState))
+			value, _ := spans[0].Attribute(AttrError)
+			assert.Equal(t, spans[0].Err().Error(), value)
+			assert.NoError(t, spans[1].Err())
+		}
+
+		tracer.Reset()
+		assert.Empty(t, tracer.Spans())
+	})
+}
+
+func TestNoopTracer(t *testing.T) {
+	ctx := context.Background()
+	spanCtx, span := NoopTracer{}.Start(ctx, "span")
+	assert.Equal(t, ctx, spanCtx)
+	assert.Equal(t, ctx, NoopTracer{}.ContextWithSpan(ctx, span))
+	endSpan(span, errors.New("error"))
+}
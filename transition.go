@@ -1,8 +1,17 @@
 package go_fsm
 
+import "context"
+
 type (
 	// transition function is using to add an additional behavior after transition to the next state
 	TransitionFunc = func(from, to State, fsmCtx FsmContext) error
+
+	// Guard reports whether a declarative transition is allowed
+	Guard = func(eventCtx EventContext, fsmCtx FsmContext) bool
+
+	// TransitionAction changes FSM context data within a declarative transition,
+	// returned nil context means the context is not changed
+	TransitionAction = func(eventCtx EventContext, fsmCtx FsmContext) (FsmContext, error)
 )
 
 type transitionKey struct {
@@ -12,3 +21,141 @@ type transitionKey struct {
 func newTransitionKey(from State, to State) transitionKey {
 	return transitionKey{from: from, to: to}
 }
+
+// keys of transition functions which match the transition, from the most specific to the least specific one
+func transitionKeys(from, to State) []transitionKey {
+	return []transitionKey{
+		newTransitionKey(from, to),
+		newTransitionKey(from, "*"),
+		newTransitionKey("*", to),
+		newTransitionKey("*", "*"),
+	}
+}
+
+// HookKind is a kind of transition functions
+type HookKind = string
+
+const (
+	HookPreCommit      HookKind = "pre_commit"
+	HookPostTransition HookKind = "post_transition"
+	HookEntry          HookKind = "entry"
+	HookExit           HookKind = "exit"
+)
+
+// HookKey identifies transition functions of the kind registered for the pair of states ("*" matches any state),
+// entry functions have only To state and exit functions have only From state
+type HookKey struct {
+	Kind HookKind
+	From State
+	To   State
+}
+
+// states of the key as they're shown in reports
+func (k HookKey) states() string {
+	switch k.Kind {
+	case HookEntry:
+		return k.To
+	case HookExit:
+		return k.From
+	}
+	return k.From + " -> " + k.To
+}
+
+// Transition is a declarative transition from one state to another on the event
+type Transition struct {
+	From  State
+	Event Event
+	To    State
+	// optional guard and its name which is used in diagrams and reports
+	Guard     Guard
+	GuardName string
+	// optional action which changes FSM context data
+	Action TransitionAction
+	// Internal self-transition changes data only, post transition functions are not called
+	Internal bool
+	// optional compensation which is called when the transaction containing the transition is rolled back
+	Compensation Compensation
+}
+
+// TransitionOption configures a declarative transition
+type TransitionOption func(*Transition)
+
+// GuardOption set guard of the transition, the transition is skipped if the guard returns false
+func GuardOption(name string, guard Guard) TransitionOption {
+	return func(t *Transition) {
+		t.GuardName, t.Guard = name, guard
+	}
+}
+
+// TransitionActionOption set action which changes FSM context data within the transition
+func TransitionActionOption(action TransitionAction) TransitionOption {
+	return func(t *Transition) {
+		t.Action = action
+	}
+}
+
+// CompensationOption set compensation of the transition action (see Compensate)
+func CompensationOption(compensation Compensation) TransitionOption {
+	return func(t *Transition) {
+		t.Compensation = compensation
+	}
+}
+
+// InternalOption makes a self-transition internal, it's ignored if states of the transition differ
+func InternalOption() TransitionOption {
+	return func(t *Transition) {
+		t.Internal = true
+	}
+}
+
+// state and event pair which is used to find declarative transitions
+type eventKey struct {
+	state State
+	event Event
+}
+
+// action function which performs the first declarative transition allowed by its guard
+func transitionsAction(transitions []Transition) ActionFunc {
+	return func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+		for _, t := range transitions {
+			if t.Guard != nil && !t.Guard(eventCtx, fsmCtx) {
+				continue
+			}
+
+			// a dry run evaluates guards only, the internal mark is kept as ProcessEvent sees it
+			if IsDryRun(eventCtx) {
+				if t.Internal && t.From == t.To {
+					return t.To, InternalTransition(nil), nil
+				}
+				return t.To, nil, nil
+			}
+			if t.Action != nil {
+				if nextFsmCtx, err = t.Action(eventCtx, fsmCtx); err != nil {
+					return "", nil, err
+				}
+			}
+			if t.Compensation != nil {
+				Compensate(eventCtx, t.Compensation)
+			}
+			if t.Internal && t.From == t.To {
+				nextFsmCtx = InternalTransition(nextFsmCtx)
+			}
+			return t.To, nextFsmCtx, nil
+		}
+
+		return "", nil, ErrNotHandled
+	}
+}
+
+// context of an internal self-transition
+type internalContext struct {
+	context.Context
+}
+
+// InternalTransition marks a self-transition returned by an action function as internal:
+// FSM context is replaced by the given one (nil keeps the current context), but exit, entry, pre-commit and
+// post transition functions are not called and the state timeout is not re-armed. It's ignored if the action
+// returns another state. A self-transition without the mark is external: the state is exited and entered again.
+func InternalTransition(ctx FsmContext) FsmContext {
+	return internalContext{Context: ctx}
+}
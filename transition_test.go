@@ -1,11 +1,243 @@
 package go_fsm
 
 import (
-	"github.com/stretchr/testify/assert"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_newTransitionKey(t *testing.T) {
 	key := newTransitionKey("from", "to")
 	assert.Equal(t, transitionKey{"from", "to"}, key)
 }
+
+// transition action which puts the value into FSM context
+func setValueAction(value string) TransitionAction {
+	return func(eventCtx EventContext, fsmCtx FsmContext) (FsmContext, error) {
+		return context.WithValue(fsmCtx, testCtxKey("value"), value), nil
+	}
+}
+
+func TestDefinition_On(t *testing.T) {
+	allowed := func(allow bool) Guard {
+		return func(eventCtx EventContext, fsmCtx FsmContext) bool {
+			return allow
+		}
+	}
+
+	t.Run("Guards and precedence", func(t *testing.T) {
+		fsm, err := NewDefinition().
+			When("idle", emptyStateActionFunc("fallback")).
+			When("fallback", nil).
+			When("running", nil).
+			On("idle", "go", "denied", GuardOption("never", allowed(false))).
+			On("idle", "go", "running", GuardOption("always", allowed(true)), TransitionActionOption(setValueAction("running"))).
+			On("idle", "go", "late").
+			On("idle", "stop", "stopped", GuardOption("never", allowed(false))).
+			NewInstance("idle")
+		assert.NoError(t, err)
+
+		assert.NoError(t, fsm.ProcessEvent("go", nil))
+		assert.Equal(t, "running", fsm.CurrentState())
+		assert.Equal(t, "running", fsm.ctx.Value(testCtxKey("value")))
+
+		// states of transitions are registered, the state without transitions has no actions
+		assert.True(t, errors.Is(fsm.ProcessEvent("go", nil), ErrActionNotFound))
+
+		// the state action is called if no transition is allowed
+		fsm, err = fsm.Definition().NewInstance("idle")
+		assert.NoError(t, err)
+		assert.NoError(t, fsm.ProcessEvent("stop", nil))
+		assert.Equal(t, "fallback", fsm.CurrentState())
+	})
+
+	t.Run("Action error", func(t *testing.T) {
+		actionErr := errors.New("action error")
+		fsm, err := NewFsm().
+			On("idle", "go", "running", TransitionActionOption(func(eventCtx EventContext, fsmCtx FsmContext) (FsmContext, error) {
+				return nil, actionErr
+			})).
+			InitWithState("idle")
+		assert.NoError(t, err)
+
+		assert.True(t, errors.Is(fsm.ProcessEvent("go", nil), actionErr))
+		assert.Equal(t, "idle", fsm.CurrentState())
+	})
+}
+
+func TestFsm_SelfTransitions(t *testing.T) {
+	newFsm := func(hooks *int32) *Fsm {
+		hook := func(from, to State, fsmCtx FsmContext) error {
+			atomic.AddInt32(hooks, 1)
+			return nil
+		}
+		fsm, err := NewDefinition().
+			On("idle", "external", "idle", TransitionActionOption(setValueAction("external"))).
+			On("idle", "internal", "idle", InternalOption(), TransitionActionOption(setValueAction("internal"))).
+			On("idle", "go", "running", InternalOption()).
+			When("running", nil).
+			When("idle", func(eventCtx EventContext, fsmCtx FsmContext) (next State, nextFsmCtx FsmContext, err error) {
+				event, _ := EventFromCtx(eventCtx)
+				if event == "keep" {
+					return "idle", InternalTransition(nil), nil
+				}
+				return "", nil, ErrNotHandled
+			}).
+			StateTimeout("idle", time.Hour, "timeout").
+			RegisterPostTransitionFunc("idle", "idle", hook).
+			RegisterPostTransitionFunc("*", "*", hook).
+			NewInstance("idle")
+		assert.NoError(t, err)
+		return fsm
+	}
+
+	t.Run("External", func(t *testing.T) {
+		var hooks int32
+		fsm := newFsm(&hooks)
+		notifications, cancel := fsm.Subscribe(nil)
+		defer cancel()
+		_, deadline, _ := fsm.Timeout()
+
+		assert.NoError(t, fsm.ProcessEvent("external", nil))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&hooks))
+		assert.Equal(t, "external", fsm.ctx.Value(testCtxKey("value")))
+		_, rearmed, _ := fsm.Timeout()
+		assert.True(t, rearmed.After(deadline))
+		n := <-notifications
+		assert.False(t, n.Internal)
+	})
+
+	t.Run("Internal", func(t *testing.T) {
+		var hooks int32
+		fsm := newFsm(&hooks)
+		notifications, cancel := fsm.Subscribe(nil)
+		defer cancel()
+		_, deadline, _ := fsm.Timeout()
+
+		assert.NoError(t, fsm.ProcessEvent("internal", nil))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&hooks))
+		assert.Equal(t, "idle", fsm.CurrentState())
+		assert.Equal(t, "internal", fsm.ctx.Value(testCtxKey("value")))
+		_, notRearmed, _ := fsm.Timeout()
+		assert.Equal(t, deadline, notRearmed)
+		n := <-notifications
+		assert.True(t, n.Internal)
+		assert.Equal(t, "idle", n.From)
+		assert.Equal(t, "idle", n.To)
+	})
+
+	t.Run("Internal from action keeps context", func(t *testing.T) {
+		var hooks int32
+		fsm := newFsm(&hooks)
+		ctx := fsm.ctx
+
+		assert.NoError(t, fsm.ProcessEvent("keep", nil))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&hooks))
+		assert.Equal(t, ctx, fsm.ctx)
+	})
+
+	t.Run("Internal is ignored for another state", func(t *testing.T) {
+		var hooks int32
+		fsm := newFsm(&hooks)
+
+		assert.NoError(t, fsm.ProcessEvent("go", nil))
+		assert.Equal(t, "running", fsm.CurrentState())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hooks))
+	})
+}
+
+func TestFsm_EntryAndExitFunctions(t *testing.T) {
+	newFsm := func(calls *[]string) *Fsm {
+		var mu sync.Mutex
+		record := func(name string) TransitionFunc {
+			return func(from, to State, fsmCtx FsmContext) error {
+				mu.Lock()
+				defer mu.Unlock()
+				*calls = append(*calls, name+" "+from+" -> "+to)
+				return nil
+			}
+		}
+		fsm, err := NewDefinition().
+			On("idle", "external", "idle").
+			On("idle", "internal", "idle", InternalOption()).
+			On("idle", "go", "running").
+			When("running", nil).
+			OnExit("idle", record("exit")).
+			OnEnter("idle", record("entry")).
+			OnEnter("running", record("entry")).
+			RegisterPreCommitFunc("*", "*", record("pre-commit")).
+			RegisterPostTransitionFunc("*", "*", record("post")).
+			NewInstance("idle")
+		assert.NoError(t, err)
+		return fsm
+	}
+
+	t.Run("Order", func(t *testing.T) {
+		var calls []string
+		fsm := newFsm(&calls)
+
+		assert.NoError(t, fsm.ProcessEvent("go", nil))
+		assert.Equal(t, []string{"exit idle -> running", "entry idle -> running", "pre-commit idle -> running", "post idle -> running"}, calls)
+		assert.Equal(t, []HookKey{
+			{Kind: HookExit, From: "idle"},
+			{Kind: HookEntry, To: "idle"},
+			{Kind: HookEntry, To: "running"},
+			{Kind: HookPreCommit, From: "*", To: "*"},
+			{Kind: HookPostTransition, From: "*", To: "*"},
+		}, fsm.Definition().Hooks())
+	})
+
+	t.Run("Self-transitions", func(t *testing.T) {
+		var calls []string
+		fsm := newFsm(&calls)
+
+		assert.NoError(t, fsm.ProcessEvent("internal", nil))
+		assert.Empty(t, calls)
+		assert.NoError(t, fsm.ProcessEvent("external", nil))
+		assert.Equal(t, []string{"exit idle -> idle", "entry idle -> idle", "pre-commit idle -> idle", "post idle -> idle"}, calls)
+	})
+
+	t.Run("Entry function rejects the transition", func(t *testing.T) {
+		var compensated []string
+		entryErr := errors.New("not ready")
+		fsm, err := newSagaDefinition(&compensated).
+			OnEnter("reserved", func(from, to State, fsmCtx FsmContext) error {
+				return entryErr
+			}).
+			NewInstance("new")
+		assert.NoError(t, err)
+		ctx := fsm.ctx
+
+		assert.True(t, errors.Is(fsm.ProcessEvent("reserve", nil), entryErr))
+		assert.Equal(t, []string{"release"}, compensated)
+		assert.Equal(t, "new", fsm.CurrentState())
+		assert.Equal(t, ctx, fsm.ctx)
+	})
+
+	t.Run("Post transition function compensation", func(t *testing.T) {
+		var compensated []string
+		var registered int32
+		fsm, err := newSagaDefinition(&compensated).
+			RegisterPostTransitionFunc("new", "reserved", func(from, to State, fsmCtx FsmContext) error {
+				if Compensate(fsmCtx, func(eventCtx EventContext) error {
+					compensated = append(compensated, "notify")
+					return nil
+				}) {
+					atomic.AddInt32(&registered, 1)
+				}
+				return nil
+			}).
+			NewInstance("new")
+		assert.NoError(t, err)
+
+		assert.Error(t, fsm.ProcessBatch([]Event{"reserve", "charge", "ship"}, nil))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&registered))
+		assert.Equal(t, []string{"cancel shipping", "refund", "notify", "release"}, compensated)
+		assert.Equal(t, "new", fsm.CurrentState())
+	})
+}
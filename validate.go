@@ -0,0 +1,276 @@
+package go_fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationReport is a result of the static definition validation,
+// it's based on declarative transitions and registered states
+type ValidationReport struct {
+	InitialState State
+	// the initial state is not registered
+	UnknownInitialState bool
+	// states which can't be reached from the initial state
+	Unreachable []State
+	// non-final states without outgoing transitions
+	DeadEnds []State
+	// transitions to states which are not registered by When, Final or as a source of another transition,
+	// including targets declared by TargetsOption (From is "*" for all-state and unhandled event actions)
+	UnknownTargets []Transition
+	// transition functions registered for pairs of states which can never occur
+	UnusedHooks []HookKey
+	// states with action functions without declared targets (see TargetsOption), transitions made by such
+	// functions are not visible to the validation, so states are not reported as unreachable if an opaque state
+	// is reachable. All states are opaque if an all-state or unhandled event action has no declared targets.
+	Opaque []State
+}
+
+// Valid reports whether the definition has no problems
+func (r ValidationReport) Valid() bool {
+	return !r.UnknownInitialState && len(r.Unreachable) == 0 && len(r.DeadEnds) == 0 &&
+		len(r.UnknownTargets) == 0 && len(r.UnusedHooks) == 0
+}
+
+// Problems return human readable descriptions of found problems
+func (r ValidationReport) Problems() []string {
+	var problems []string
+	if r.UnknownInitialState {
+		problems = append(problems, fmt.Sprintf("initial state [%s] is not registered", r.InitialState))
+	}
+	for _, state := range r.Unreachable {
+		problems = append(problems, fmt.Sprintf("state [%s] is unreachable from [%s]", state, r.InitialState))
+	}
+	for _, state := range r.DeadEnds {
+		problems = append(problems, fmt.Sprintf("state [%s] is not final and has no outgoing transitions", state))
+	}
+	for _, t := range r.UnknownTargets {
+		switch {
+		case t.Event != "":
+			problems = append(problems, fmt.Sprintf("transition from [%s] on event [%s] targets unregistered state [%s]", t.From, t.Event, t.To))
+		case t.From == "*":
+			problems = append(problems, fmt.Sprintf("unhandled event action targets unregistered state [%s]", t.To))
+		default:
+			problems = append(problems, fmt.Sprintf("action function of [%s] targets unregistered state [%s]", t.From, t.To))
+		}
+	}
+	for _, hook := range r.UnusedHooks {
+		problems = append(problems, fmt.Sprintf("%s function [%s] is never called", hook.Kind, hook.states()))
+	}
+	return problems
+}
+
+// Err returns ValidationError if the definition has problems
+func (r ValidationReport) Err() error {
+	if r.Valid() {
+		return nil
+	}
+	return &ValidationError{Report: r}
+}
+
+// ValidationError is returned by ValidationReport.Err
+type ValidationError struct {
+	Report ValidationReport
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid definition: " + strings.Join(e.Report.Problems(), "; ")
+}
+
+//Validate check the definition statically, reachability is checked only if the initial state is not empty
+func (def *Definition) Validate(initialState State) ValidationReport {
+	s := def.load()
+	report := ValidationReport{InitialState: initialState}
+
+	// all-state and unhandled event actions without declared targets can make a transition from any state
+	anyOpaque := s.anyOpaque()
+	isOpaque := func(state State) bool {
+		return anyOpaque || s.isOpaque(state)
+	}
+
+	states := make([]State, 0, len(s.actionMap))
+	for state := range s.actionMap {
+		states = append(states, state)
+		if s.isOpaque(state) {
+			report.Opaque = append(report.Opaque, state)
+		}
+	}
+	sort.Strings(states)
+	sort.Strings(report.Opaque)
+
+	outgoing := map[State][]State{}
+	for _, t := range s.transitions {
+		if t.To != t.From {
+			outgoing[t.From] = append(outgoing[t.From], t.To)
+		}
+		if s.implicitStates[t.To] {
+			report.UnknownTargets = append(report.UnknownTargets, t)
+		}
+	}
+	// declared targets of action functions, "*" source matches any state
+	for _, t := range s.actionTransitions() {
+		for _, state := range states {
+			if (t.From == "*" || t.From == state) && t.To != state {
+				outgoing[state] = append(outgoing[state], t.To)
+			}
+		}
+		if !s.isStateExists(t.To) {
+			report.UnknownTargets = append(report.UnknownTargets, t)
+		}
+	}
+
+	for _, state := range states {
+		if !s.finalStates[state] && !s.implicitStates[state] && len(outgoing[state]) == 0 && !isOpaque(state) {
+			report.DeadEnds = append(report.DeadEnds, state)
+		}
+	}
+
+	// entry and exit functions of unregistered states are never called
+	isUnknown := func(state State) bool {
+		return !s.isStateExists(state)
+	}
+
+	if initialState != "" {
+		if !s.isStateExists(initialState) {
+			report.UnknownInitialState = true
+		} else {
+			report.Unreachable = s.unreachable(initialState, states, outgoing, isOpaque)
+		}
+	}
+
+	report.UnusedHooks = append(report.UnusedHooks, stateHookKeys(HookExit, s.exitFuncMap, isUnknown)...)
+	report.UnusedHooks = append(report.UnusedHooks, stateHookKeys(HookEntry, s.entryFuncMap, isUnknown)...)
+	report.UnusedHooks = append(report.UnusedHooks, s.unusedHooks(HookPreCommit, s.preCommitFuncMap, anyOpaque)...)
+	report.UnusedHooks = append(report.UnusedHooks, s.unusedHooks(HookPostTransition, s.postTransitionFuncMap, anyOpaque)...)
+
+	return report
+}
+
+//Validate check FSM definition statically starting from the initial state of FSM
+func (fsm *Fsm) Validate() ValidationReport {
+	return fsm.def.Validate(fsm.initialState)
+}
+
+// states which are not reachable from the initial state by declarative transitions,
+// nothing is reported if an opaque state is reachable
+func (s *definitionSnapshot) unreachable(initialState State, states []State, outgoing map[State][]State, isOpaque func(State) bool) []State {
+	reached := map[State]bool{initialState: true}
+	queue := []State{initialState}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		if isOpaque(state) {
+			return nil
+		}
+		for _, next := range outgoing[state] {
+			if !reached[next] {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	var unreachable []State
+	for _, state := range states {
+		if !reached[state] && !s.implicitStates[state] {
+			unreachable = append(unreachable, state)
+		}
+	}
+	return unreachable
+}
+
+// keys of transition functions which are never called
+func (s *definitionSnapshot) unusedHooks(kind HookKind, funcMap map[transitionKey][]*HookRegistration, anyOpaque bool) []HookKey {
+	return hookKeys(kind, funcMap, func(key transitionKey) bool {
+		return !s.mayOccur(key, anyOpaque)
+	})
+}
+
+// reports whether a transition between the pair of states ("*" matches any state) may occur
+func (s *definitionSnapshot) mayOccur(key transitionKey, anyOpaque bool) bool {
+	for _, state := range []State{key.from, key.to} {
+		if state != "*" && !s.isStateExists(state) {
+			return false
+		}
+	}
+	if anyOpaque {
+		return true
+	}
+
+	// an opaque action function of the source state can make any transition
+	for state := range s.actionMap {
+		if s.isOpaque(state) && (key.from == "*" || key.from == state) {
+			return true
+		}
+	}
+	for _, t := range s.actionTransitions() {
+		if (key.from == "*" || t.From == "*" || key.from == t.From) && (key.to == "*" || key.to == t.To) {
+			return true
+		}
+	}
+	for _, t := range s.transitions {
+		// internal transitions don't call transition functions
+		if t.Internal && t.From == t.To {
+			continue
+		}
+		if (key.from == "*" || key.from == t.From) && (key.to == "*" || key.to == t.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// reports whether the state action function has no declared targets
+func (s *definitionSnapshot) isOpaque(state State) bool {
+	_, declared := s.stateTargets[state]
+	return s.actionMap[state] != nil && !declared
+}
+
+// reports whether an all-state or unhandled event action function has no declared targets
+func (s *definitionSnapshot) anyOpaque() bool {
+	for event, action := range s.anyStateActionMap {
+		if _, declared := s.anyStateTargets[event]; action != nil && !declared {
+			return true
+		}
+	}
+	return s.unhandledAction != nil && s.unhandledTargets == nil
+}
+
+// transitions to declared targets of action functions (see TargetsOption), ordered by states and events.
+// The source state is "*" for all-state and unhandled event actions.
+func (s *definitionSnapshot) actionTransitions() []Transition {
+	var transitions []Transition
+	states := make([]State, 0, len(s.stateTargets))
+	for state := range s.stateTargets {
+		if s.actionMap[state] != nil {
+			states = append(states, state)
+		}
+	}
+	sort.Strings(states)
+	for _, state := range states {
+		for _, to := range s.stateTargets[state] {
+			transitions = append(transitions, Transition{From: state, To: to})
+		}
+	}
+
+	events := make([]Event, 0, len(s.anyStateTargets))
+	for event := range s.anyStateTargets {
+		if s.anyStateActionMap[event] != nil {
+			events = append(events, event)
+		}
+	}
+	sort.Strings(events)
+	for _, event := range events {
+		for _, to := range s.anyStateTargets[event] {
+			transitions = append(transitions, Transition{From: "*", Event: event, To: to})
+		}
+	}
+
+	if s.unhandledAction != nil {
+		for _, to := range s.unhandledTargets {
+			transitions = append(transitions, Transition{From: "*", To: to})
+		}
+	}
+	return transitions
+}
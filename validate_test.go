@@ -0,0 +1,152 @@
+package go_fsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefinition_Validate(t *testing.T) {
+	hook := func(from, to State, fsmCtx FsmContext) error {
+		return nil
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		fsm, err := NewFsm().
+			On("new", "pay", "paid").
+			On("new", "cancel", "cancelled").
+			On("paid", "ship", "shipped").
+			On("paid", "touch", "paid", InternalOption()).
+			Final("shipped", "cancelled").
+			RegisterPostTransitionFunc("*", "shipped", hook).
+			RegisterPreCommitFunc("new", "*", hook).
+			InitWithState("new")
+		assert.NoError(t, err)
+
+		report := fsm.Validate()
+		assert.True(t, report.Valid())
+		assert.NoError(t, report.Err())
+		assert.Empty(t, report.Problems())
+		assert.Empty(t, report.Opaque)
+	})
+
+	t.Run("Problems", func(t *testing.T) {
+		def := NewDefinition().
+			On("new", "pay", "paid").
+			On("paid", "ship", "shiped").
+			On("paid", "touch", "paid", InternalOption()).
+			On("lost", "find", "new").
+			When("stuck", nil).
+			Final("shipped").
+			RegisterPostTransitionFunc("paid", "paid", hook).
+			RegisterPostTransitionFunc("new", "unknown", hook).
+			RegisterPreCommitFunc("shipped", "*", hook).
+			OnEnter("unknown", hook).
+			OnExit("paid", hook)
+
+		report := def.Validate("new")
+		assert.False(t, report.Valid())
+		assert.Equal(t, []State{"lost", "shipped", "stuck"}, report.Unreachable)
+		assert.Equal(t, []State{"stuck"}, report.DeadEnds)
+		if assert.Len(t, report.UnknownTargets, 1) {
+			assert.Equal(t, "shiped", report.UnknownTargets[0].To)
+		}
+		assert.Equal(t, []HookKey{
+			{Kind: HookEntry, To: "unknown"},
+			{Kind: HookPreCommit, From: "shipped", To: "*"},
+			{Kind: HookPostTransition, From: "new", To: "unknown"},
+			{Kind: HookPostTransition, From: "paid", To: "paid"},
+		}, report.UnusedHooks)
+		assert.Equal(t, []string{
+			"state [lost] is unreachable from [new]",
+			"state [shipped] is unreachable from [new]",
+			"state [stuck] is unreachable from [new]",
+			"state [stuck] is not final and has no outgoing transitions",
+			"transition from [paid] on event [ship] targets unregistered state [shiped]",
+			"entry function [unknown] is never called",
+			"pre_commit function [shipped -> *] is never called",
+			"post_transition function [new -> unknown] is never called",
+			"post_transition function [paid -> paid] is never called",
+		}, report.Problems())
+
+		err := report.Err()
+		assert.IsType(t, &ValidationError{}, err)
+		assert.Contains(t, err.Error(), "invalid definition: state [lost] is unreachable from [new]; ")
+
+		assert.Equal(t, ValidationReport{InitialState: "unknown", UnknownInitialState: true}, NewDefinition().Validate("unknown"))
+	})
+
+	t.Run("Action functions", func(t *testing.T) {
+		def := NewDefinition().
+			When("new", emptyStateActionFunc("paid")).
+			When("paid", nil).
+			When("lost", nil).
+			Final("paid").
+			RegisterPostTransitionFunc("new", "paid", hook)
+
+		report := def.Validate("new")
+		assert.Equal(t, []State{"new"}, report.Opaque)
+		assert.Empty(t, report.Unreachable)
+		assert.Equal(t, []State{"lost"}, report.DeadEnds)
+		assert.Empty(t, report.UnusedHooks)
+
+		// all-state actions can leave any state
+		report = def.WhenAny("shutdown", emptyStateActionFunc("paid")).Validate("")
+		assert.Empty(t, report.DeadEnds)
+	})
+
+	t.Run("Declared targets", func(t *testing.T) {
+		def := NewDefinition().
+			When("new", emptyStateActionFunc("paid"), TargetsOption("paid")).
+			When("paid", nil).
+			When("stuck", nil).
+			When("audit", emptyStateActionFunc("audit"), TargetsOption("audit", "missing")).
+			On("paid", "ship", "shipped").
+			Final("shipped", "cancelled").
+			WhenAny("cancel", emptyStateActionFunc("cancelled"), TargetsOption("cancelled")).
+			WhenUnhandled(emptyStateActionFunc("lost"), TargetsOption("lost")).
+			RegisterPostTransitionFunc("paid", "cancelled", hook).
+			RegisterPostTransitionFunc("paid", "new", hook)
+
+		report := def.Validate("new")
+		assert.Empty(t, report.Opaque)
+		assert.Equal(t, []State{"audit", "stuck"}, report.Unreachable)
+		assert.Empty(t, report.DeadEnds)
+		assert.Equal(t, []HookKey{{Kind: HookPostTransition, From: "paid", To: "new"}}, report.UnusedHooks)
+		assert.Equal(t, []string{
+			"state [audit] is unreachable from [new]",
+			"state [stuck] is unreachable from [new]",
+			"action function of [audit] targets unregistered state [missing]",
+			"unhandled event action targets unregistered state [lost]",
+			"post_transition function [paid -> new] is never called",
+		}, report.Problems())
+
+		// an undeclared all-state action makes all states opaque again
+		report = def.WhenAny("reset", emptyStateActionFunc("new")).Validate("new")
+		assert.Empty(t, report.Unreachable)
+	})
+
+	t.Run("Runtime agrees with the report", func(t *testing.T) {
+		fsm, err := NewFsm().
+			When("new", emptyStateActionFunc("cancelled"), TargetsOption("paid")).
+			Final("cancelled").
+			On("new", "pay", "paid").
+			InitWithState("new")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"state [cancelled] is unreachable from [new]",
+			"transition from [new] on event [pay] targets unregistered state [paid]",
+			"action function of [new] targets unregistered state [paid]",
+		}, fsm.Validate().Problems())
+
+		// the target of the declarative transition is not registered
+		assert.True(t, errors.Is(fsm.ProcessEvent("pay", nil), ErrUnknownNextState))
+		// the action function returns an undeclared target
+		err = fsm.ProcessEvent("cancel", nil)
+		assert.True(t, errors.Is(err, ErrUnknownNextState))
+		assert.EqualError(t, err, "transition from [new] on event [cancel] failed: "+
+			"unknown next state: [cancelled] is not a target of the action function")
+		assert.Equal(t, "new", fsm.CurrentState())
+	})
+}